@@ -2,34 +2,295 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
 
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/config"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/database"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	token := flag.String("token", "", "A token to be set as custom rate limiter")
 	maxReq := flag.Int64("maxreq", 0, "The max request token can make in a period of time")
+	billingAnchor := flag.String("billing-anchor", "", "The RFC 3339 start of the token billing cycle, which periods of the rules follow")
+	actor := flag.String("actor", defaultActor(), "Who is making the change, recorded in the audit log")
+
+	reset := flag.Bool("reset", false, "Reset the counter of the key given by -ip or -api-key")
+	setUsage := flag.Int64("set-usage", -1, "Set how much of the current window the key has used")
+	bonus := flag.Int64("bonus", 0, "Grant the key a bonus allowance")
+	bonusTTL := flag.Duration("bonus-ttl", time.Hour, "How long the bonus allowance lasts")
+	ip := flag.String("ip", "", "The IP whose counter is changed")
+	apiKey := flag.String("api-key", "", "The API key whose counter is changed")
+	method := flag.String("method", "GET", "The method of the route whose counter is changed")
+	path := flag.String("path", "/", "The path of the route whose counter is changed")
+
+	exportToken := flag.String("export-usage", "", "Export the usage of the token to the standard output")
+	from := flag.String("from", "", "The RFC 3339 instant or date the usage export starts at, 30 days ago by default")
+	to := flag.String("to", "", "The RFC 3339 instant or date the usage export ends at, now by default")
+	granularity := flag.String("granularity", usage.GranularityDay, "The usage buckets: hour or day")
+	format := flag.String("format", "csv", "The usage export format: csv or jsonl")
 
 	flag.Parse()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
 	if *token != "" {
-		fmt.Printf("Saving rate limiter token \"%s\" to allow %d requests...\n", *token, *maxReq)
+		if err := saveToken(logger, *token, *maxReq, *billingAnchor, *actor); err != nil {
+			logger.Error("unable to register token", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *reset || *setUsage >= 0 || *bonus > 0 {
+		descriptor := ratelimiter.Descriptor{Method: *method, Path: *path, ClientIP: *ip, APIKey: *apiKey}
+		change := counterChange{reset: *reset, used: *setUsage, bonus: *bonus, bonusTTL: *bonusTTL}
+		if err := changeCounter(logger, descriptor, change, *actor); err != nil {
+			logger.Error("unable to change counter", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *exportToken != "" {
+		if err := exportUsage(os.Stdout, *exportToken, *from, *to, *granularity, *format); err != nil {
+			logger.Error("unable to export usage", "error", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func defaultActor() string {
+	if current, err := user.Current(); err == nil {
+		return "cli:" + current.Username
+	}
+	return "cli"
+}
+
+func connect() (*config.Conf, *database.RedisDatabase, error) {
+	cfg, err := config.Load(".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load config: %w", err)
+	}
+	logging.SetHashSecret(cfg.KeyHashSecret)
+
+	redisDB, err := database.NewRedisDatabase(*cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to Redis: %w", err)
+	}
+
+	return cfg, redisDB, nil
+}
+
+func saveToken(logger *slog.Logger, token string, maxReq int64, billingAnchor string, actor string) error {
+	if billingAnchor != "" {
+		if _, err := time.Parse(time.RFC3339, billingAnchor); err != nil {
+			return fmt.Errorf("invalid billing anchor: %w", err)
+		}
+	}
+
+	cfg, redisDB, err := connect()
+	if err != nil {
+		return err
+	}
+	defer redisDB.Close()
+
+	logger.Info("saving rate limiter token", "token_hash", logging.HashKey(token), "max_requests", maxReq)
+
+	ctx := context.Background()
+	key := fmt.Sprintf("token_max_req:%s", token)
+	previous, err := redisDB.Client.SetArgs(ctx, key, maxReq, redis.SetArgs{Get: true}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	if billingAnchor != "" {
+		if err := redisDB.Client.Set(ctx, fmt.Sprintf("token_anchor:%s", token), billingAnchor, 0).Err(); err != nil {
+			return fmt.Errorf("token saved without its billing anchor: %w", err)
+		}
+	}
+
+	logger.Info("token registered")
+
+	action := audit.ActionTokenCreate
+	if previous != "" {
+		action = audit.ActionTokenUpdate
+	}
+	auditLog := audit.NewRedisLog(redisDB.Client, audit.DefaultStream, int64(cfg.AuditMaxEntries), time.Now)
+	if err := auditLog.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: action,
+		Target: logging.HashKey(token),
+		Before: previous,
+		After:  strconv.FormatInt(maxReq, 10),
+	}); err != nil {
+		return fmt.Errorf("token saved but not audited: %w", err)
+	}
+
+	return nil
+}
+
+type counterChange struct {
+	reset    bool
+	used     int64
+	bonus    int64
+	bonusTTL time.Duration
+}
 
-		cfg, err := config.Load(".")
+// changeCounter applies the changes to the counter of the descriptor's
+// enforced rule, auditing each of them like the admin API does.
+func changeCounter(logger *slog.Logger, descriptor ratelimiter.Descriptor, change counterChange, actor string) error {
+	if descriptor.ClientIP == "" && descriptor.APIKey == "" {
+		return errors.New("-ip or -api-key is required")
+	}
+	if change.bonus > 0 && change.bonusTTL <= 0 {
+		return errors.New("-bonus-ttl must be positive")
+	}
+
+	cfg, redisDB, err := connect()
+	if err != nil {
+		return err
+	}
+	defer redisDB.Close()
+
+	rules, err := ratelimiter.LoadRules(cfg.RulesFile)
+	if err != nil {
+		return fmt.Errorf("cannot load rules: %w", err)
+	}
+
+	quotaLocation, err := time.LoadLocation(cfg.QuotaTimeZone)
+	if err != nil {
+		return fmt.Errorf("cannot load the quota time zone: %w", err)
+	}
+
+	ctx := context.Background()
+	limiter := ratelimiter.NewRateLimiter(strategies.NewRedisLimiter(redisDB.Client, time.Now), cfg.IPMaxRequests, cfg.TimeWindowMilliseconds, rules, logger)
+	limiter.Calendar = ratelimiter.NewCalendar(quotaLocation, time.Now)
+	auditLog := audit.NewRedisLog(redisDB.Client, audit.DefaultStream, int64(cfg.AuditMaxEntries), time.Now)
+
+	apply := func(action string, after string, run func() error) error {
+		before, err := limiter.Peek(ctx, descriptor)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		// unknown tokens fall back to the counter of an empty IP
+		if descriptor.ClientIP == "" && before.KeyType != ratelimiter.KeyTypeToken {
+			return errors.New("token not found")
+		}
+		if err := run(); err != nil {
+			return err
+		}
+
+		logger.Info("counter changed", "action", action, "rule", before.Rule, "key_hash", logging.HashKey(before.Key))
+		if err := auditLog.Record(ctx, audit.Entry{
+			Actor:  actor,
+			Action: action,
+			Target: audit.CounterTarget(before.Rule, before.KeyType, logging.HashKey(before.Key)),
+			Before: fmt.Sprintf("used=%d limit=%d", before.Total, before.Limit),
+			After:  after,
+		}); err != nil {
+			return fmt.Errorf("counter changed but not audited: %w", err)
+		}
+		return nil
+	}
+
+	if change.reset {
+		if err := apply(audit.ActionCounterReset, "used=0", func() error { return limiter.Reset(ctx, descriptor) }); err != nil {
+			return err
+		}
+	}
+	if change.used >= 0 {
+		after := "used=" + strconv.FormatInt(change.used, 10)
+		if err := apply(audit.ActionCounterSet, after, func() error { return limiter.SetUsage(ctx, descriptor, change.used) }); err != nil {
+			return err
+		}
+	}
+	if change.bonus > 0 {
+		after := fmt.Sprintf("bonus=%d ttl=%s", change.bonus, change.bonusTTL)
+		if err := apply(audit.ActionCounterBonus, after, func() error { return limiter.Grant(ctx, descriptor, change.bonus, change.bonusTTL) }); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+// exportUsage writes the usage buckets of the token as CSV, with a header
+// row, or as JSON lines.
+func exportUsage(w io.Writer, token string, from string, to string, granularity string, format string) error {
+	if format != "csv" && format != "jsonl" {
+		return fmt.Errorf("unknown format %q", format)
+	}
 
-		redisDB, err := database.NewRedisDatabase(*cfg)
+	query := usage.Query{Token: token, To: time.Now(), Granularity: granularity}
+	if to != "" {
+		instant, err := parseInstant(to)
 		if err != nil {
-			panic("cannot connect to Redis")
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+		query.To = instant
+	}
+	query.From = query.To.AddDate(0, 0, -30)
+	if from != "" {
+		instant, err := parseInstant(from)
+		if err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+		query.From = instant
+	}
+
+	cfg, redisDB, err := connect()
+	if err != nil {
+		return err
+	}
+	defer redisDB.Close()
+
+	reader := usage.NewRedisUsage(redisDB.Client, cfg.UsageRetention, cfg.UsageFlushInterval, slog.Default(), time.Now)
+	buckets, err := reader.Report(context.Background(), query)
+	if err != nil {
+		return err
+	}
+
+	if format == "jsonl" {
+		encoder := json.NewEncoder(w)
+		for _, bucket := range buckets {
+			if err := encoder.Encode(bucket); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
 
-		key := fmt.Sprintf("token_max_req:%s", *token)
-		redisDB.Client.Set(context.Background(), key, *maxReq, 0)
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"start", "allowed", "denied"})
+	for _, bucket := range buckets {
+		csvWriter.Write([]string{
+			bucket.Start.Format(time.RFC3339),
+			strconv.FormatInt(bucket.Allowed, 10),
+			strconv.FormatInt(bucket.Denied, 10),
+		})
+	}
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
 
-		fmt.Println("Token registered.")
+// parseInstant reads an RFC 3339 instant or a date, taken as UTC midnight.
+func parseInstant(value string) (time.Time, error) {
+	if instant, err := time.Parse(time.RFC3339, value); err == nil {
+		return instant, nil
 	}
+	return time.Parse(time.DateOnly, value)
 }
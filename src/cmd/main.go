@@ -1,58 +1,414 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/config"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/database"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/proxy"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/rls"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/telemetry"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/web"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/web/handlers"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/web/middlewares"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/httpmw"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
 )
 
+const (
+	ModeServer = "server"
+	ModeProxy  = "proxy"
+)
+
 func main() {
+	// the image has neither a shell nor curl, so container health checks run
+	// the binary itself
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		if err := healthcheck(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(); err != nil {
+		slog.Error("application stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
 	cfg, err := config.Load(".")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("cannot load config: %w", err)
+	}
+
+	logger, err := logging.NewLogger(*cfg, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("cannot create logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	logging.SetHashSecret(cfg.KeyHashSecret)
+	if cfg.KeyHashSecret == "" {
+		logger.Warn("KEY_HASH_SECRET is not set, key hashes will not match across instances and restarts")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := telemetry.SetupTracing(context.Background(), *cfg)
+	if err != nil {
+		return fmt.Errorf("cannot set up tracing: %w", err)
 	}
+	defer shutdownTracing(context.Background())
 
 	redisDB, err := database.NewRedisDatabase(*cfg)
 	if err != nil {
-		panic("cannot connect to Redis")
+		return fmt.Errorf("cannot connect to Redis: %w", err)
+	}
+	defer redisDB.Close()
+
+	rules, err := ratelimiter.LoadRules(cfg.RulesFile)
+	if err != nil {
+		return fmt.Errorf("cannot load rules: %w", err)
+	}
+
+	quotaLocation, err := time.LoadLocation(cfg.QuotaTimeZone)
+	if err != nil {
+		return fmt.Errorf("cannot load the quota time zone: %w", err)
+	}
+
+	responder, err := httpmw.LoadResponder(rules, cfg.DenyHTMLTemplate, cfg.DenyTextTemplate)
+	if err != nil {
+		return fmt.Errorf("cannot load deny templates: %w", err)
+	}
+
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+
+	eventBus := events.NewRedisBus(redisDB.Client, events.DefaultChannel, instanceID, 1024, logger.With("component", "events"), time.Now)
+	go eventBus.Run(ctx)
+
+	auditLog := audit.NewRedisLog(redisDB.Client, audit.DefaultStream, int64(cfg.AuditMaxEntries), time.Now)
+
+	appMetrics := metrics.NewMetrics()
+
+	usageLog := usage.NewRedisUsage(redisDB.Client, cfg.UsageRetention, cfg.UsageFlushInterval, logger.With("component", "usage"), time.Now)
+	go usageLog.Run(ctx)
+
+	redisStrategy := strategies.NewTracedStrategy(
+		metrics.NewInstrumentedStrategy(strategies.NewRedisLimiter(redisDB.Client, time.Now), "redis", appMetrics, time.Now),
+		"RedisLimiter",
+	)
+	rateLimiter := ratelimiter.NewRateLimiter(redisStrategy, cfg.IPMaxRequests, cfg.TimeWindowMilliseconds, rules, logger.With("component", "ratelimiter"))
+	rateLimiter.Calendar = ratelimiter.NewCalendar(quotaLocation, time.Now)
+	adaptiveLimiter := ratelimiter.NewAdaptiveLimiter(
+		strategies.NewRedisAdaptiveLimiter(redisDB.Client),
+		rateLimiter,
+		logger.With("component", "adaptive"),
+		cfg.AdaptiveSyncInterval,
+	)
+	rateLimiter.Adaptive = adaptiveLimiter
+	go adaptiveLimiter.Run(ctx)
+	queuedLimiter := ratelimiter.NewQueuedRateLimiter(rateLimiter, strategies.NewRedisQueue(redisDB.Client), time.Now)
+	rlMiddleware := middlewares.NewRateLimiterMiddleware(
+		queuedLimiter,
+		responder,
+		cfg.ShadowDenyHeader,
+		appMetrics,
+		logger.With("component", "middleware"),
+		logging.NewSampler(cfg.LogDenySampleEvery),
+		eventBus,
+		cfg.RefundHeader,
+		usageLog,
+	)
+	concurrencyMiddleware := httpmw.NewConcurrencyMiddleware(
+		ratelimiter.NewConcurrencyLimiter(strategies.NewRedisConcurrencyLimiter(redisDB.Client), rateLimiter, cfg.ConcurrencyLease),
+	)
+	concurrencyMiddleware.Responder = responder
+	concurrencyMiddleware.Observer = rlMiddleware
+	concurrencyMiddleware.Logger = logger.With("component", "concurrency")
+	adaptiveMiddleware := middlewares.NewAdaptiveMiddleware(adaptiveLimiter, time.Now)
+	if cfg.RLSGRPCPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.RLSGRPCPort))
+		if err != nil {
+			return fmt.Errorf("cannot listen for the rate limit service: %w", err)
+		}
+		rlsService := rls.NewService(rateLimiter, appMetrics, logger.With("component", "rls"), time.Now)
+		go func() {
+			if err := rlsService.Serve(ctx, listener); err != nil {
+				logger.Error("rate limit service stopped", "error", err)
+			}
+		}()
 	}
 
-	redisStrategy := strategies.NewRedisLimiter(redisDB.Client, time.Now)
-	rateLimiter := ratelimiter.NewRateLimiter(redisStrategy, cfg.IPMaxRequests, cfg.TimeWindowMilliseconds)
-	rlMiddleware := middlewares.NewRateLimiterMiddleware(rateLimiter)
+	adminAuth := middlewares.NewAdminAuthMiddleware(cfg.AdminAPIKey)
+	forwardAuth := middlewares.RequestID(http.HandlerFunc(rlMiddleware.ForwardAuth))
+	statusHandler := handlers.NewStatusHandler(rateLimiter, logger.With("component", "status_handler"))
+	ownStatus := middlewares.RequestID(http.HandlerFunc(statusHandler.Own))
+	requestID := web.Middleware{
+		Name:    "RequestID",
+		Handler: middlewares.RequestID,
+	}
+	// the concurrency slot is taken before the quota is counted, so requests
+	// denied for concurrency do not spend quota
 	middlewares := []web.Middleware{
+		requestID,
+		{
+			Name:    "Concurrency",
+			Handler: concurrencyMiddleware.Handler,
+		},
 		{
 			Name:    "RateLimiter",
 			Handler: rlMiddleware.Handle,
 		},
+		{
+			Name:    "Adaptive",
+			Handler: adaptiveMiddleware.Handle,
+		},
 	}
 
-	exampleHandler := handlers.NewExampleHandler()
-	tokenHandler := handlers.NewTokenHandler(redisDB.Client)
-	handlers := []web.Handler{
+	counterHandler := handlers.NewCounterHandler(rateLimiter, logger.With("component", "counter_handler"), auditLog)
+	usageHandler := handlers.NewUsageHandler(usageLog, logger.With("component", "usage_handler"), time.Now)
+	auditHandler := handlers.NewAuditHandler(auditLog, logger.With("component", "audit_handler"))
+	eventsHandler := handlers.NewEventsHandler(eventBus, 15*time.Second, logger.With("component", "events_handler"))
+	// config and rules are loaded before serving, a failure stops startup
+	healthChecks := []handlers.HealthCheck{
+		{Name: "redis", Check: redisDB.Ping},
+	}
+
+	var routes []web.Handler
+	switch cfg.Mode {
+	case ModeServer:
+		exampleHandler := handlers.NewExampleHandler()
+		tokenHandler := handlers.NewTokenHandler(redisDB.Client, logger.With("component", "token_handler"), eventBus, auditLog)
+		routes = []web.Handler{
+			{
+				Path:        "/",
+				Method:      "GET",
+				HandlerFunc: exampleHandler.Get,
+			},
+			{
+				Path:        "/token",
+				Method:      "POST",
+				HandlerFunc: adminAuth.Handle(http.HandlerFunc(tokenHandler.Create)).ServeHTTP,
+			},
+			{
+				Path:        "/token/{token}",
+				Method:      "DELETE",
+				HandlerFunc: adminAuth.Handle(http.HandlerFunc(tokenHandler.Delete)).ServeHTTP,
+			},
+		}
+	case ModeProxy:
+		upstreamProxy, err := newProxy(*cfg, logger.With("component", "proxy"))
+		if err != nil {
+			return fmt.Errorf("cannot set up the proxy: %w", err)
+		}
+		go upstreamProxy.Run(ctx)
+
+		healthChecks = append(healthChecks, handlers.HealthCheck{Name: "upstreams", Check: upstreamProxy.Ready})
+		routes = []web.Handler{
+			{
+				Path:        "/*",
+				HandlerFunc: upstreamProxy.ServeHTTP,
+			},
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+
+	healthHandler := handlers.NewHealthHandler(healthChecks, 2*time.Second, logger.With("component", "health_handler"))
+	managementRoutes := []web.Handler{
 		{
-			Path:        "/",
+			// scrapes must neither be limited nor counted
+			Path:            "/metrics",
+			Method:          "GET",
+			HandlerFunc:     appMetrics.Handler().ServeHTTP,
+			SkipMiddlewares: true,
+		},
+		{
+			Path:        "/admin/events",
+			Method:      "GET",
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(eventsHandler.Stream)).ServeHTTP,
+		},
+		{
+			Path:        "/admin/ratelimit/status",
 			Method:      "GET",
-			HandlerFunc: exampleHandler.Get,
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(statusHandler.Inspect)).ServeHTTP,
+		},
+		{
+			Path:        "/admin/ratelimit/reset",
+			Method:      "POST",
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(counterHandler.Reset)).ServeHTTP,
+		},
+		{
+			Path:        "/admin/ratelimit/usage",
+			Method:      "PUT",
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(counterHandler.SetUsage)).ServeHTTP,
 		},
 		{
-			Path:        "/token",
+			Path:        "/admin/ratelimit/bonus",
 			Method:      "POST",
-			HandlerFunc: tokenHandler.Create,
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(counterHandler.Grant)).ServeHTTP,
+		},
+		{
+			// reading the quota must not consume it
+			Path:            "/ratelimit/status",
+			Method:          "GET",
+			HandlerFunc:     ownStatus.ServeHTTP,
+			SkipMiddlewares: true,
+		},
+		{
+			Path:        "/admin/usage",
+			Method:      "GET",
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(usageHandler.Report)).ServeHTTP,
+		},
+		{
+			Path:        "/admin/audit",
+			Method:      "GET",
+			HandlerFunc: adminAuth.Handle(http.HandlerFunc(auditHandler.List)).ServeHTTP,
+		},
+		{
+			// decides for an ingress; the limit applies to the original request
+			Path:            "/forward-auth",
+			HandlerFunc:     forwardAuth.ServeHTTP,
+			SkipMiddlewares: true,
+		},
+		{
+			Path:            "/healthz",
+			Method:          "GET",
+			HandlerFunc:     healthHandler.Live,
+			SkipMiddlewares: true,
+		},
+		{
+			Path:            "/readyz",
+			Method:          "GET",
+			HandlerFunc:     healthHandler.Ready,
+			SkipMiddlewares: true,
 		},
 	}
 
+	serverOptions := web.ServerOptions{
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		DrainTimeout:      cfg.ShutdownDrainTimeout,
+		ShutdownDelay:     cfg.ShutdownDelay,
+	}
+	if cfg.TLSCertFile != "" {
+		serverOptions.TLSConfig, err = web.NewTLSConfig(web.TLSOptions{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+			ClientAuth:   cfg.TLSClientAuth,
+		}, logger.With("component", "tls"))
+		if err != nil {
+			return fmt.Errorf("cannot set up TLS: %w", err)
+		}
+	}
+
+	// every path of the proxy belongs to the upstreams, so the endpoints of
+	// the limiter itself get a listener of their own
+	if cfg.Mode == ModeProxy {
+		if cfg.AdminPort == cfg.WebServerPort {
+			return errors.New("ADMIN_PORT must differ from WEB_SERVER_PORT in proxy mode")
+		}
+
+		adminServer := web.NewServer(
+			cfg.AdminPort,
+			managementRoutes,
+			[]web.Middleware{requestID},
+			serverOptions,
+			logger.With("component", "admin_server"),
+		)
+		adminServer.OnShutdown(healthHandler.Drain)
+		adminServer.OnShutdown(eventsHandler.Close)
+		go func() {
+			if err := adminServer.Run(ctx); err != nil {
+				logger.Error("admin server stopped", "error", err)
+			}
+		}()
+	} else {
+		routes = append(routes, managementRoutes...)
+	}
+
 	server := web.NewServer(
 		cfg.WebServerPort,
-		handlers,
+		routes,
 		middlewares,
+		serverOptions,
+		logger.With("component", "server"),
 	)
+	server.OnShutdown(healthHandler.Drain)
+	server.OnShutdown(eventsHandler.Close)
+
+	return server.Run(ctx)
+}
+
+// healthcheck fails unless the local instance answers /readyz with 200.
+func healthcheck() error {
+	cfg, err := config.Load(".")
+	if err != nil {
+		return fmt.Errorf("cannot load config: %w", err)
+	}
+
+	scheme := "http"
+	client := &http.Client{Timeout: 2 * time.Second}
+	if cfg.TLSCertFile != "" {
+		scheme = "https"
+		// the certificate names the public host, not the loopback address
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	port := cfg.WebServerPort
+	if cfg.Mode == ModeProxy {
+		port = cfg.AdminPort
+	}
+
+	response, err := client.Get(fmt.Sprintf("%s://127.0.0.1:%d/readyz", scheme, port))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("instance is not ready: %s", response.Status)
+	}
+	return nil
+}
+
+// newProxy fronts the upstreams of PROXY_UPSTREAMS_FILE, or the single
+// PROXY_UPSTREAM_URL.
+func newProxy(cfg config.Conf, logger *slog.Logger) (*proxy.Proxy, error) {
+	upstreams := []proxy.Upstream{{Name: "default", URL: cfg.ProxyUpstreamURL, HealthPath: cfg.ProxyHealthPath}}
+	if cfg.ProxyUpstreamsFile != "" {
+		var err error
+		if upstreams, err = proxy.LoadUpstreams(cfg.ProxyUpstreamsFile); err != nil {
+			return nil, err
+		}
+	}
 
-	server.Run()
+	client := &http.Client{Timeout: cfg.ProxyHealthInterval}
+	return proxy.NewProxy(upstreams, client, cfg.ProxyHealthInterval, logger)
 }
@@ -1,15 +1,60 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Conf struct {
-	WebServerPort          int    `mapstructure:"WEB_SERVER_PORT"`
-	RedisHost              string `mapstructure:"REDIS_HOST"`
-	RedisPort              int    `mapstructure:"REDIS_PORT"`
-	RedisPass              string `mapstructure:"REDIS_PASSWORD"`
-	RedisDB                int    `mapstructure:"REDIS_DB"`
-	IPMaxRequests          int    `mapstructure:"IP_MAX_REQUESTS"`
-	TimeWindowMilliseconds int    `mapstructure:"LIMIT_TIME_WINDOW_MS"`
+	WebServerPort          int           `mapstructure:"WEB_SERVER_PORT"`
+	RedisHost              string        `mapstructure:"REDIS_HOST"`
+	RedisPort              int           `mapstructure:"REDIS_PORT"`
+	RedisPass              string        `mapstructure:"REDIS_PASSWORD"`
+	RedisDB                int           `mapstructure:"REDIS_DB"`
+	IPMaxRequests          int           `mapstructure:"IP_MAX_REQUESTS"`
+	TimeWindowMilliseconds int           `mapstructure:"LIMIT_TIME_WINDOW_MS"`
+	RulesFile              string        `mapstructure:"RULES_FILE"`
+	DenyHTMLTemplate       string        `mapstructure:"DENY_HTML_TEMPLATE"`
+	DenyTextTemplate       string        `mapstructure:"DENY_TEXT_TEMPLATE"`
+	ShadowDenyHeader       bool          `mapstructure:"SHADOW_DENY_HEADER"`
+	RefundHeader           bool          `mapstructure:"REFUND_HEADER"`
+	ConcurrencyLease       time.Duration `mapstructure:"CONCURRENCY_LEASE"`
+	AdaptiveSyncInterval   time.Duration `mapstructure:"ADAPTIVE_SYNC_INTERVAL"`
+	QuotaTimeZone          string        `mapstructure:"QUOTA_TIME_ZONE"`
+	UsageRetention         time.Duration `mapstructure:"USAGE_RETENTION"`
+	UsageFlushInterval     time.Duration `mapstructure:"USAGE_FLUSH_INTERVAL"`
+	TracingExporter        string        `mapstructure:"TRACING_EXPORTER"`
+	TracingOTLPEndpoint    string        `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	TracingOTLPInsecure    bool          `mapstructure:"TRACING_OTLP_INSECURE"`
+	TracingServiceName     string        `mapstructure:"TRACING_SERVICE_NAME"`
+	TracingSampleRatio     float64       `mapstructure:"TRACING_SAMPLE_RATIO"`
+	LogFormat              string        `mapstructure:"LOG_FORMAT"`
+	LogLevel               string        `mapstructure:"LOG_LEVEL"`
+	LogDenySampleEvery     int           `mapstructure:"LOG_DENY_SAMPLE_EVERY"`
+	KeyHashSecret          string        `mapstructure:"KEY_HASH_SECRET"`
+	AdminAPIKey            string        `mapstructure:"ADMIN_API_KEY"`
+	InstanceID             string        `mapstructure:"INSTANCE_ID"`
+	AuditMaxEntries        int           `mapstructure:"AUDIT_MAX_ENTRIES"`
+	HTTPReadTimeout        time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`
+	HTTPReadHeaderTimeout  time.Duration `mapstructure:"HTTP_READ_HEADER_TIMEOUT"`
+	HTTPWriteTimeout       time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT"`
+	HTTPIdleTimeout        time.Duration `mapstructure:"HTTP_IDLE_TIMEOUT"`
+	HTTPMaxHeaderBytes     int           `mapstructure:"HTTP_MAX_HEADER_BYTES"`
+	ShutdownDrainTimeout   time.Duration `mapstructure:"SHUTDOWN_DRAIN_TIMEOUT"`
+	ShutdownDelay          time.Duration `mapstructure:"SHUTDOWN_DELAY"`
+	TLSCertFile            string        `mapstructure:"TLS_CERT_FILE"`
+	TLSKeyFile             string        `mapstructure:"TLS_KEY_FILE"`
+	TLSClientCAFile        string        `mapstructure:"TLS_CLIENT_CA_FILE"`
+	TLSClientAuth          string        `mapstructure:"TLS_CLIENT_AUTH"`
+	Mode                   string        `mapstructure:"MODE"`
+	AdminPort              int           `mapstructure:"ADMIN_PORT"`
+	ProxyUpstreamURL       string        `mapstructure:"PROXY_UPSTREAM_URL"`
+	ProxyUpstreamsFile     string        `mapstructure:"PROXY_UPSTREAMS_FILE"`
+	ProxyHealthPath        string        `mapstructure:"PROXY_HEALTH_PATH"`
+	ProxyHealthInterval    time.Duration `mapstructure:"PROXY_HEALTH_INTERVAL"`
+	RLSGRPCPort            int           `mapstructure:"RLS_GRPC_PORT"`
 }
 
 func Load(path string) (*Conf, error) {
@@ -21,13 +66,71 @@ func Load(path string) (*Conf, error) {
 	viper.SetConfigFile(".env")
 	viper.AutomaticEnv()
 
+	viper.SetDefault("RULES_FILE", "")
+	viper.SetDefault("DENY_HTML_TEMPLATE", "")
+	viper.SetDefault("DENY_TEXT_TEMPLATE", "")
+	viper.SetDefault("SHADOW_DENY_HEADER", false)
+	viper.SetDefault("REFUND_HEADER", false)
+	viper.SetDefault("CONCURRENCY_LEASE", "30s")
+	viper.SetDefault("ADAPTIVE_SYNC_INTERVAL", "1s")
+	viper.SetDefault("QUOTA_TIME_ZONE", "UTC")
+	viper.SetDefault("USAGE_RETENTION", "2160h")
+	viper.SetDefault("USAGE_FLUSH_INTERVAL", "1s")
+	viper.SetDefault("TRACING_EXPORTER", "none")
+	viper.SetDefault("TRACING_OTLP_ENDPOINT", "")
+	viper.SetDefault("TRACING_OTLP_INSECURE", false)
+	viper.SetDefault("TRACING_SERVICE_NAME", "rate-limiter")
+	viper.SetDefault("TRACING_SAMPLE_RATIO", 1.0)
+	viper.SetDefault("LOG_FORMAT", "json")
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_DENY_SAMPLE_EVERY", 1)
+	viper.SetDefault("KEY_HASH_SECRET", "")
+	viper.SetDefault("ADMIN_API_KEY", "")
+	viper.SetDefault("INSTANCE_ID", "")
+	viper.SetDefault("AUDIT_MAX_ENTRIES", 10000)
+	viper.SetDefault("HTTP_READ_TIMEOUT", "10s")
+	viper.SetDefault("HTTP_READ_HEADER_TIMEOUT", "5s")
+	viper.SetDefault("HTTP_WRITE_TIMEOUT", "30s")
+	viper.SetDefault("HTTP_IDLE_TIMEOUT", "120s")
+	viper.SetDefault("HTTP_MAX_HEADER_BYTES", 1<<20)
+	viper.SetDefault("SHUTDOWN_DRAIN_TIMEOUT", "15s")
+	viper.SetDefault("SHUTDOWN_DELAY", "0s")
+	viper.SetDefault("TLS_CERT_FILE", "")
+	viper.SetDefault("TLS_KEY_FILE", "")
+	viper.SetDefault("TLS_CLIENT_CA_FILE", "")
+	viper.SetDefault("TLS_CLIENT_AUTH", "none")
+	viper.SetDefault("MODE", "server")
+	viper.SetDefault("ADMIN_PORT", 9090)
+	viper.SetDefault("PROXY_UPSTREAM_URL", "")
+	viper.SetDefault("PROXY_UPSTREAMS_FILE", "")
+	viper.SetDefault("PROXY_HEALTH_PATH", "")
+	viper.SetDefault("PROXY_HEALTH_INTERVAL", "5s")
+	viper.SetDefault("RLS_GRPC_PORT", 0)
+
 	if err := viper.ReadInConfig(); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if err := viper.Unmarshal(&c); err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
 	}
 
 	return c, nil
 }
+
+// validate rejects the values that would break the server at runtime rather
+// than at startup.
+func (c *Conf) validate() error {
+	// leases are renewed every half lease and stored in milliseconds
+	if c.ConcurrencyLease < time.Second {
+		return errors.New("CONCURRENCY_LEASE must be at least 1s")
+	}
+	if c.AdaptiveSyncInterval <= 0 {
+		return errors.New("ADAPTIVE_SYNC_INTERVAL must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validConf() *Conf {
+	return &Conf{
+		ConcurrencyLease:     30 * time.Second,
+		AdaptiveSyncInterval: time.Second,
+	}
+}
+
+func TestConfValidate(t *testing.T) {
+	t.Run("Should accept the defaults", func(t *testing.T) {
+		assert.NoError(t, validConf().validate())
+	})
+
+	t.Run("Should reject concurrency leases under a second", func(t *testing.T) {
+		for _, lease := range []time.Duration{0, time.Nanosecond, 500 * time.Millisecond} {
+			conf := validConf()
+			conf.ConcurrencyLease = lease
+
+			assert.Error(t, conf.validate(), lease.String())
+		}
+	})
+
+	t.Run("Should reject adaptive sync intervals that are not positive", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			conf := validConf()
+			conf.AdaptiveSyncInterval = interval
+
+			assert.Error(t, conf.validate(), interval.String())
+		}
+	})
+}
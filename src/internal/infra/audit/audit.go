@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultStream = "ratelimiter:audit"
+
+	ActionTokenCreate = "token.create"
+	ActionTokenUpdate = "token.update"
+	ActionTokenDelete = "token.delete"
+
+	ActionCounterReset = "counter.reset"
+	ActionCounterSet   = "counter.set"
+	ActionCounterBonus = "counter.bonus"
+
+	queryBatchSize = 500
+)
+
+type Entry struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	// Source is the address an API change came from, recorded whatever
+	// actor the caller declares.
+	Source string `json:"source,omitempty"`
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// CounterTarget names a rate limit counter by its rule, key type and key hash,
+// so keys are never written to the log.
+func CounterTarget(rule string, keyType string, keyHash string) string {
+	return rule + ":" + keyType + ":" + keyHash
+}
+
+type Query struct {
+	From  time.Time
+	To    time.Time
+	Actor string
+	Limit int
+}
+
+type Recorder interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+type Reader interface {
+	Query(ctx context.Context, query Query) ([]Entry, error)
+}
+
+// RedisLog appends entries to a Redis stream trimmed to about MaxLen entries.
+// Stream IDs carry the Redis time of each entry, so time ranges map to XRANGE
+// bounds.
+type RedisLog struct {
+	Client *redis.Client
+	Stream string
+	MaxLen int64
+	Now    func() time.Time
+}
+
+func NewRedisLog(client *redis.Client, stream string, maxLen int64, now func() time.Time) *RedisLog {
+	return &RedisLog{
+		Client: client,
+		Stream: stream,
+		MaxLen: maxLen,
+		Now:    now,
+	}
+}
+
+func (l *RedisLog) Record(ctx context.Context, entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = l.Now()
+	}
+
+	return l.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: l.Stream,
+		MaxLen: l.MaxLen,
+		Approx: true,
+		Values: []string{
+			"time", entry.Time.UTC().Format(time.RFC3339Nano),
+			"actor", entry.Actor,
+			"source", entry.Source,
+			"action", entry.Action,
+			"target", entry.Target,
+			"before", entry.Before,
+			"after", entry.After,
+		},
+	}).Err()
+}
+
+func (l *RedisLog) Query(ctx context.Context, query Query) ([]Entry, error) {
+	start := "-"
+	if !query.From.IsZero() {
+		start = strconv.FormatInt(query.From.UnixMilli(), 10)
+	}
+	end := "+"
+	if !query.To.IsZero() {
+		end = strconv.FormatInt(query.To.UnixMilli(), 10)
+	}
+
+	entries := []Entry{}
+	for {
+		messages, err := l.Client.XRangeN(ctx, l.Stream, start, end, queryBatchSize).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		for _, message := range messages {
+			entry := toEntry(message)
+			if query.Actor != "" && entry.Actor != query.Actor {
+				continue
+			}
+
+			entries = append(entries, entry)
+			if query.Limit > 0 && len(entries) >= query.Limit {
+				return entries, nil
+			}
+		}
+
+		if len(messages) < queryBatchSize {
+			return entries, nil
+		}
+		// exclusive range, resuming right after the last message read
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+func toEntry(message redis.XMessage) Entry {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+
+	entryTime, _ := time.Parse(time.RFC3339Nano, field("time"))
+
+	return Entry{
+		ID:     message.ID,
+		Time:   entryTime,
+		Actor:  field("actor"),
+		Source: field("source"),
+		Action: field("action"),
+		Target: field("target"),
+		Before: field("before"),
+		After:  field("after"),
+	}
+}
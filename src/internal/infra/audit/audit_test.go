@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+}
+
+func TestRedisLogRecord(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	log := NewRedisLog(db, DefaultStream, 1000, mockNow)
+
+	clientMock.ExpectXAdd(&redis.XAddArgs{
+		Stream: DefaultStream,
+		MaxLen: 1000,
+		Approx: true,
+		Values: []string{
+			"time", "2024-10-24T03:00:00Z",
+			"actor", "alice",
+			"source", "ip:192.0.2.1",
+			"action", ActionTokenUpdate,
+			"target", "abc",
+			"before", "10",
+			"after", "20",
+		},
+	}).SetVal("1729738800000-0")
+
+	err := log.Record(context.Background(), Entry{
+		Actor:  "alice",
+		Source: "ip:192.0.2.1",
+		Action: ActionTokenUpdate,
+		Target: "abc",
+		Before: "10",
+		After:  "20",
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, clientMock.ExpectationsWereMet())
+}
+
+func TestRedisLogQuery(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	log := NewRedisLog(db, DefaultStream, 1000, mockNow)
+
+	messages := []redis.XMessage{
+		{ID: "1729738800000-0", Values: map[string]interface{}{"time": "2024-10-24T03:00:00Z", "actor": "alice", "action": ActionTokenCreate, "target": "abc", "after": "10"}},
+		{ID: "1729738801000-0", Values: map[string]interface{}{"time": "2024-10-24T03:00:01Z", "actor": "bob", "action": ActionTokenDelete, "target": "abc", "before": "10"}},
+		{ID: "1729738802000-0", Values: map[string]interface{}{"time": "2024-10-24T03:00:02Z", "actor": "alice", "action": ActionTokenUpdate, "target": "abc", "before": "10", "after": "20"}},
+	}
+
+	t.Run("Should filter by time range and actor", func(t *testing.T) {
+		from := mockNow()
+		to := mockNow().Add(time.Minute)
+		clientMock.ExpectXRangeN(DefaultStream, "1729738800000", "1729738860000", queryBatchSize).SetVal(messages)
+
+		entries, err := log.Query(context.Background(), Query{From: from, To: to, Actor: "alice"})
+
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, Entry{
+			ID:     "1729738802000-0",
+			Time:   mockNow().Add(2 * time.Second),
+			Actor:  "alice",
+			Action: ActionTokenUpdate,
+			Target: "abc",
+			Before: "10",
+			After:  "20",
+		}, entries[1])
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should stop at the limit", func(t *testing.T) {
+		clientMock.ExpectXRangeN(DefaultStream, "-", "+", queryBatchSize).SetVal(messages)
+
+		entries, err := log.Query(context.Background(), Query{Limit: 1})
+
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "alice", entries[0].Actor)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
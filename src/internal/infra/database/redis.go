@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/config"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/telemetry"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -25,6 +27,12 @@ func NewRedisDatabase(
 		DB:       cfg.RedisDB,
 	})
 
+	if telemetry.TracingEnabled(cfg) {
+		if err := redisotel.InstrumentTracing(client); err != nil {
+			return nil, err
+		}
+	}
+
 	if _, err := client.Ping(context.Background()).Result(); err != nil {
 		return nil, err
 	}
@@ -33,3 +41,11 @@ func NewRedisDatabase(
 		Client: client,
 	}, nil
 }
+
+func (db *RedisDatabase) Ping(ctx context.Context) error {
+	return db.Client.Ping(ctx).Err()
+}
+
+func (db *RedisDatabase) Close() error {
+	return db.Client.Close()
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	TypeDecision    = "decision"
+	TypeTokenChange = "token_change"
+
+	DecisionDenied       = "denied"
+	DecisionShadowDenied = "shadow_denied"
+)
+
+// Event is a limiter occurrence shared across instances. Keys are only ever
+// carried hashed.
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"`
+	Decision string    `json:"decision,omitempty"`
+	Rule     string    `json:"rule,omitempty"`
+	KeyType  string    `json:"key_type,omitempty"`
+	KeyHash  string    `json:"key_hash,omitempty"`
+	Method   string    `json:"method,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Limit    int64     `json:"limit,omitempty"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+type Subscriber interface {
+	Subscribe(ctx context.Context) (<-chan Event, error)
+}
+
+type NopPublisher struct{}
+
+func (NopPublisher) Publish(ctx context.Context, event Event) {}
+
+// Filter keeps the events matching every informed field. Empty fields match
+// anything.
+type Filter struct {
+	Types     []string
+	Rules     []string
+	KeyTypes  []string
+	Decisions []string
+}
+
+func ParseFilter(types, rules, keyTypes, decisions string) Filter {
+	return Filter{
+		Types:     splitValues(types),
+		Rules:     splitValues(rules),
+		KeyTypes:  splitValues(keyTypes),
+		Decisions: splitValues(decisions),
+	}
+}
+
+func (f Filter) Matches(event Event) bool {
+	return matchesAny(f.Types, event.Type) &&
+		matchesAny(f.Rules, event.Rule) &&
+		matchesAny(f.KeyTypes, event.KeyType) &&
+		matchesAny(f.Decisions, event.Decision)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func splitValues(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
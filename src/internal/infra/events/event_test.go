@@ -0,0 +1,32 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatches(t *testing.T) {
+	deny := Event{Type: TypeDecision, Decision: DecisionDenied, Rule: "export", KeyType: "token"}
+	tokenChange := Event{Type: TypeTokenChange, KeyType: "token"}
+
+	t.Run("Should match everything when empty", func(t *testing.T) {
+		filter := ParseFilter("", "", "", "")
+
+		assert.True(t, filter.Matches(deny))
+		assert.True(t, filter.Matches(tokenChange))
+	})
+
+	t.Run("Should match any of the informed values", func(t *testing.T) {
+		filter := ParseFilter("", "default, export", "token", "")
+
+		assert.True(t, filter.Matches(deny))
+		assert.False(t, filter.Matches(tokenChange))
+	})
+
+	t.Run("Should require every informed field", func(t *testing.T) {
+		filter := ParseFilter(TypeDecision, "", "ip", DecisionDenied)
+
+		assert.False(t, filter.Matches(deny))
+	})
+}
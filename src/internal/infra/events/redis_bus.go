@@ -0,0 +1,120 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultChannel = "ratelimiter:events"
+
+// RedisBus fans events in from every instance through Redis pub/sub. Publish
+// never blocks the request: events are queued and dropped when the queue is
+// full.
+type RedisBus struct {
+	Client   *redis.Client
+	Channel  string
+	Instance string
+	Logger   *slog.Logger
+	Now      func() time.Time
+	queue    chan Event
+}
+
+func NewRedisBus(
+	client *redis.Client,
+	channel string,
+	instance string,
+	queueSize int,
+	logger *slog.Logger,
+	now func() time.Time,
+) *RedisBus {
+	return &RedisBus{
+		Client:   client,
+		Channel:  channel,
+		Instance: instance,
+		Logger:   logger,
+		Now:      now,
+		queue:    make(chan Event, queueSize),
+	}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, event Event) {
+	event.Instance = b.Instance
+	if event.Time.IsZero() {
+		event.Time = b.Now()
+	}
+
+	select {
+	case b.queue <- event:
+	default:
+		b.Logger.WarnContext(ctx, "event queue full, dropping event", "type", event.Type)
+	}
+}
+
+// Run sends the queued events to Redis until the context is done.
+func (b *RedisBus) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-b.queue:
+			b.send(ctx, event)
+		}
+	}
+}
+
+func (b *RedisBus) send(ctx context.Context, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		b.Logger.ErrorContext(ctx, "unable to encode event", "error", err)
+		return
+	}
+
+	if err := b.Client.Publish(ctx, b.Channel, payload).Err(); err != nil {
+		b.Logger.ErrorContext(ctx, "unable to publish event", "error", err)
+	}
+}
+
+// Subscribe listens to the events of every instance until the context is done.
+func (b *RedisBus) Subscribe(ctx context.Context) (<-chan Event, error) {
+	pubsub := b.Client.Subscribe(ctx, b.Channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event Event
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					b.Logger.WarnContext(ctx, "ignoring malformed event", "error", err)
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
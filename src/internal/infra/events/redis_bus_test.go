@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestRedisBusPublish(t *testing.T) {
+	t.Run("Should send queued events to the channel", func(t *testing.T) {
+		db, clientMock := redismock.NewClientMock()
+		bus := NewRedisBus(db, DefaultChannel, "instance-1", 10, discardLogger(), mockNow)
+
+		expected, _ := json.Marshal(Event{
+			Type:     TypeDecision,
+			Time:     mockNow(),
+			Instance: "instance-1",
+			Decision: DecisionDenied,
+			Rule:     "default",
+		})
+		clientMock.ExpectPublish(DefaultChannel, expected).SetVal(1)
+
+		bus.Publish(context.Background(), Event{Type: TypeDecision, Decision: DecisionDenied, Rule: "default"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			bus.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return clientMock.ExpectationsWereMet() == nil
+		}, time.Second, 5*time.Millisecond)
+
+		cancel()
+		<-done
+	})
+
+	t.Run("Should drop events when the queue is full", func(t *testing.T) {
+		db, _ := redismock.NewClientMock()
+		bus := NewRedisBus(db, DefaultChannel, "instance-1", 1, discardLogger(), mockNow)
+
+		bus.Publish(context.Background(), Event{Type: TypeDecision})
+		bus.Publish(context.Background(), Event{Type: TypeTokenChange})
+
+		assert.Len(t, bus.queue, 1)
+		assert.Equal(t, TypeDecision, (<-bus.queue).Type)
+	})
+}
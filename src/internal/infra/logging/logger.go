@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/config"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// ContextHandler adds the request ID found in the record context to every
+// record.
+type ContextHandler struct {
+	slog.Handler
+}
+
+func (h ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h ContextHandler) WithGroup(name string) slog.Handler {
+	return ContextHandler{h.Handler.WithGroup(name)}
+}
+
+func NewLogger(cfg config.Conf, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case FormatText:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+
+	return slog.New(ContextHandler{handler}), nil
+}
+
+// hashSecret keys the digests of HashKey. It is random until SetHashSecret is
+// called, so digests cannot be reversed by hashing every IPv4 address or a
+// list of known tokens.
+var hashSecret = randomSecret()
+
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// SetHashSecret sets the secret HashKey digests are keyed with. Instances and
+// the CLI share it so their digests match. It must be called before any key
+// is hashed; an empty secret keeps the random one.
+func SetHashSecret(secret string) {
+	if secret != "" {
+		hashSecret = []byte(secret)
+	}
+}
+
+// HashKey returns a short, stable HMAC-SHA256 digest of a limiter key so IPs
+// and tokens can be correlated in logs without being written in clear.
+func HashKey(key string) string {
+	mac := hmac.New(sha256.New, hashSecret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Sampler lets one in every N events through. N <= 0 drops every event.
+type Sampler struct {
+	every int64
+	count atomic.Int64
+}
+
+func NewSampler(every int) *Sampler {
+	return &Sampler{every: int64(every)}
+}
+
+func (s *Sampler) Sample() bool {
+	if s.every <= 0 {
+		return false
+	}
+	return (s.count.Add(1)-1)%s.every == 0
+}
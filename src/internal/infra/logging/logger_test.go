@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("Should write JSON records with the request ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := NewLogger(config.Conf{LogFormat: "json", LogLevel: "info"}, &buf)
+		assert.NoError(t, err)
+
+		ctx := WithRequestID(context.Background(), "req-1")
+		logger.InfoContext(ctx, "hello", "rule", "default")
+		logger.DebugContext(ctx, "hidden")
+
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "hello", record["msg"])
+		assert.Equal(t, "req-1", record["request_id"])
+		assert.Equal(t, "default", record["rule"])
+		assert.NotContains(t, buf.String(), "hidden")
+	})
+
+	t.Run("Should write text records", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := NewLogger(config.Conf{LogFormat: "text", LogLevel: "debug"}, &buf)
+		assert.NoError(t, err)
+
+		logger.With("component", "test").Debug("hello")
+
+		assert.Contains(t, buf.String(), "level=DEBUG msg=hello component=test")
+	})
+
+	t.Run("Should reject unknown formats and levels", func(t *testing.T) {
+		_, err := NewLogger(config.Conf{LogFormat: "xml", LogLevel: "info"}, &bytes.Buffer{})
+		assert.Error(t, err)
+
+		_, err = NewLogger(config.Conf{LogFormat: "json", LogLevel: "loud"}, &bytes.Buffer{})
+		assert.Error(t, err)
+	})
+}
+
+func TestHashKey(t *testing.T) {
+	assert.Equal(t, HashKey("127.0.0.1"), HashKey("127.0.0.1"))
+	assert.NotEqual(t, HashKey("127.0.0.1"), HashKey("127.0.0.2"))
+	assert.Len(t, HashKey("dummy_token"), 16)
+	assert.NotContains(t, HashKey("dummy_token"), "dummy")
+
+	t.Run("Should key the digest with the secret", func(t *testing.T) {
+		defer func(secret []byte) { hashSecret = secret }(hashSecret)
+
+		SetHashSecret("first")
+		first := HashKey("127.0.0.1")
+		SetHashSecret("second")
+
+		assert.NotEqual(t, first, HashKey("127.0.0.1"))
+		plain := sha256.Sum256([]byte("127.0.0.1"))
+		assert.NotEqual(t, hex.EncodeToString(plain[:8]), first)
+	})
+}
+
+func TestSampler(t *testing.T) {
+	sampler := NewSampler(3)
+	var sampled []bool
+	for i := 0; i < 6; i++ {
+		sampled = append(sampled, sampler.Sample())
+	}
+	assert.Equal(t, []bool{true, false, false, true, false, false}, sampled)
+
+	assert.False(t, NewSampler(0).Sample())
+	assert.True(t, NewSampler(1).Sample())
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	DecisionAllowed      = "allowed"
+	DecisionDenied       = "denied"
+	DecisionErrored      = "errored"
+	DecisionShadowDenied = "shadow_denied"
+
+	// UnknownLabel is used when a decision fails before the rule or key type
+	// is known.
+	UnknownLabel = "unknown"
+)
+
+// Metrics holds the limiter collectors. Labels are limited to rule names, key
+// types and strategy names so cardinality never depends on clients.
+type Metrics struct {
+	Registry     *prometheus.Registry
+	Decisions    *prometheus.CounterVec
+	CheckLatency *prometheus.HistogramVec
+}
+
+func NewMetrics() *Metrics {
+	registry := prometheus.NewRegistry()
+
+	decisions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "decisions_total",
+		Help:      "Rate limiter decisions by rule, key type and decision.",
+	}, []string{"rule", "key_type", "decision"})
+
+	checkLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ratelimiter",
+		Name:      "check_limit_duration_seconds",
+		Help:      "Latency of the strategy CheckLimit calls.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"strategy", "outcome"})
+
+	registry.MustRegister(
+		decisions,
+		checkLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return &Metrics{
+		Registry:     registry,
+		Decisions:    decisions,
+		CheckLatency: checkLatency,
+	}
+}
+
+func (m *Metrics) RecordDecision(rule string, keyType string, decision string) {
+	if rule == "" {
+		rule = UnknownLabel
+	}
+	if keyType == "" {
+		keyType = UnknownLabel
+	}
+	m.Decisions.WithLabelValues(rule, keyType, decision).Inc()
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
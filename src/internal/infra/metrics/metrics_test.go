@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsRecordDecision(t *testing.T) {
+	m := NewMetrics()
+
+	m.RecordDecision("default", "ip", DecisionAllowed)
+	m.RecordDecision("default", "ip", DecisionAllowed)
+	m.RecordDecision("export", "token", DecisionDenied)
+	m.RecordDecision("", "", DecisionErrored)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.Decisions.WithLabelValues("default", "ip", DecisionAllowed)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Decisions.WithLabelValues("export", "token", DecisionDenied)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Decisions.WithLabelValues(UnknownLabel, UnknownLabel, DecisionErrored)))
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m := NewMetrics()
+	m.RecordDecision("default", "ip", DecisionDenied)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	m.Handler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `ratelimiter_decisions_total{decision="denied",key_type="ip",rule="default"} 1`)
+}
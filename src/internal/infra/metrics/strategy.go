@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+// InstrumentedStrategy decorates a strategy observing the CheckLimit latency.
+type InstrumentedStrategy struct {
+	strategies.LimiterStrategyInterface
+	Name    string
+	Metrics *Metrics
+	Now     func() time.Time
+}
+
+func NewInstrumentedStrategy(
+	strategy strategies.LimiterStrategyInterface,
+	name string,
+	metrics *Metrics,
+	now func() time.Time,
+) *InstrumentedStrategy {
+	return &InstrumentedStrategy{
+		LimiterStrategyInterface: strategy,
+		Name:                     name,
+		Metrics:                  metrics,
+		Now:                      now,
+	}
+}
+
+func (is *InstrumentedStrategy) CheckLimit(ctx context.Context, r *strategies.Request) (*strategies.LimitResponse, error) {
+	start := is.Now()
+	result, err := is.LimiterStrategyInterface.CheckLimit(ctx, r)
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	is.Metrics.CheckLatency.WithLabelValues(is.Name, outcome).Observe(is.Now().Sub(start).Seconds())
+
+	return result, err
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStrategy struct {
+	err error
+}
+
+func (f *fakeStrategy) CheckTokenLimit(ctx context.Context, token string) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeStrategy) CheckTokenAnchor(ctx context.Context, token string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (f *fakeStrategy) CheckLimit(ctx context.Context, r *strategies.Request) (*strategies.LimitResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &strategies.LimitResponse{Result: strategies.Allow}, nil
+}
+
+func (f *fakeStrategy) Refund(ctx context.Context, r *strategies.Request) error {
+	return f.err
+}
+
+func (f *fakeStrategy) Peek(ctx context.Context, r *strategies.Request) (*strategies.LimitResponse, error) {
+	return f.CheckLimit(ctx, r)
+}
+
+func (f *fakeStrategy) Reset(ctx context.Context, r *strategies.Request) error {
+	return f.err
+}
+
+func (f *fakeStrategy) SetUsage(ctx context.Context, r *strategies.Request, used int64) error {
+	return f.err
+}
+
+func (f *fakeStrategy) Grant(ctx context.Context, r *strategies.Request, bonus int64, ttl time.Duration) error {
+	return f.err
+}
+
+func steppingNow() func() time.Time {
+	current := time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		current = current.Add(2 * time.Millisecond)
+		return current
+	}
+}
+
+func TestInstrumentedStrategyCheckLimit(t *testing.T) {
+	m := NewMetrics()
+
+	t.Run("Should observe successful calls", func(t *testing.T) {
+		strategy := NewInstrumentedStrategy(&fakeStrategy{}, "redis", m, steppingNow())
+
+		result, err := strategy.CheckLimit(context.Background(), &strategies.Request{Key: "k"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, strategies.Allow, result.Result)
+		assert.Equal(t, 1, testutil.CollectAndCount(m.CheckLatency, "ratelimiter_check_limit_duration_seconds"))
+	})
+
+	t.Run("Should observe failed calls apart", func(t *testing.T) {
+		strategy := NewInstrumentedStrategy(&fakeStrategy{err: errors.New("redis down")}, "redis", m, steppingNow())
+
+		_, err := strategy.CheckLimit(context.Background(), &strategies.Request{Key: "k"})
+
+		assert.Error(t, err)
+		assert.Equal(t, 2, testutil.CollectAndCount(m.CheckLatency, "ratelimiter_check_limit_duration_seconds"))
+	})
+}
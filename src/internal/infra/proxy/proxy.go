@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/web/handlers"
+)
+
+// limitHeaders are set by the rate limiter middleware on the response and
+// forwarded to the upstream, so it can see the caller quota.
+var limitHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+type backend struct {
+	upstream Upstream
+	target   *url.URL
+	proxy    *httputil.ReverseProxy
+	healthy  atomic.Bool
+}
+
+// Proxy forwards requests to the upstream matching their host and path. When
+// several match, host-bound upstreams win, then the longest path prefix.
+type Proxy struct {
+	Client   *http.Client
+	Interval time.Duration
+	Logger   *slog.Logger
+	backends []*backend
+}
+
+func NewProxy(upstreams []Upstream, client *http.Client, interval time.Duration, logger *slog.Logger) (*Proxy, error) {
+	p := &Proxy{
+		Client:   client,
+		Interval: interval,
+		Logger:   logger,
+	}
+
+	for _, upstream := range upstreams {
+		target, err := parseURL(upstream.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		b := &backend{upstream: upstream, target: target}
+		b.healthy.Store(true)
+		b.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.SetXForwarded()
+			},
+			ErrorHandler: p.errorHandler(upstream.Name),
+		}
+		p.backends = append(p.backends, b)
+	}
+
+	sort.SliceStable(p.backends, func(i, j int) bool {
+		a, b := p.backends[i].upstream, p.backends[j].upstream
+		if (a.Host != "") != (b.Host != "") {
+			return a.Host != ""
+		}
+		return len(a.PathPrefix) > len(b.PathPrefix)
+	})
+
+	return p, nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := p.match(r)
+	if b == nil {
+		writeMessage(w, http.StatusNotFound, "No upstream for this request")
+		return
+	}
+	if !b.healthy.Load() {
+		writeMessage(w, http.StatusServiceUnavailable, "Upstream unavailable")
+		return
+	}
+
+	out := r.Clone(r.Context())
+	for _, header := range limitHeaders {
+		out.Header.Del(header) // never trust the values sent by the caller
+		if value := w.Header().Get(header); value != "" {
+			out.Header.Set(header, value)
+		}
+	}
+
+	b.proxy.ServeHTTP(w, out)
+}
+
+func (p *Proxy) match(r *http.Request) *backend {
+	for _, b := range p.backends {
+		if b.upstream.Matches(r) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Ready fails when no upstream is healthy.
+func (p *Proxy) Ready(ctx context.Context) error {
+	for _, b := range p.backends {
+		if b.healthy.Load() {
+			return nil
+		}
+	}
+	return errors.New("no healthy upstream")
+}
+
+// Run checks the upstreams with a health path until the context is done.
+// Upstreams without one are always considered healthy.
+func (p *Proxy) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Proxy) checkAll(ctx context.Context) {
+	for _, b := range p.backends {
+		if b.upstream.HealthPath == "" {
+			continue
+		}
+
+		healthy := p.check(ctx, b)
+		if b.healthy.Swap(healthy) != healthy {
+			p.Logger.InfoContext(ctx, "upstream health changed", "upstream", b.upstream.Name, "healthy", healthy)
+		}
+	}
+}
+
+func (p *Proxy) check(ctx context.Context, b *backend) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.Interval)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.target.JoinPath(b.upstream.HealthPath).String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+func (p *Proxy) errorHandler(name string) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		p.Logger.ErrorContext(r.Context(), "upstream request failed", "upstream", name, "error", err)
+		writeMessage(w, http.StatusBadGateway, "Upstream request failed")
+	}
+}
+
+func writeMessage(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(handlers.MessageResponse{
+		Message: message,
+	})
+}
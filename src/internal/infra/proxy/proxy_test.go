@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func newUpstream(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Seen-Limit", r.Header.Get("X-RateLimit-Limit"))
+		w.Write([]byte(r.URL.Path))
+	}))
+}
+
+func TestProxyServeHTTP(t *testing.T) {
+	api := newUpstream("api")
+	defer api.Close()
+	web := newUpstream("web")
+	defer web.Close()
+	admin := newUpstream("admin")
+	defer admin.Close()
+
+	p, err := NewProxy([]Upstream{
+		{Name: "web", URL: web.URL},
+		{Name: "api", URL: api.URL, PathPrefix: "/api"},
+		{Name: "admin", URL: admin.URL, Host: "admin.example.com"},
+	}, http.DefaultClient, time.Second, discardLogger())
+	require.NoError(t, err)
+
+	t.Run("Should forward to the longest matching prefix", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		rr := httptest.NewRecorder()
+
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "api", rr.Header().Get("X-Upstream"))
+		assert.Equal(t, "/api/users", rr.Body.String())
+	})
+
+	t.Run("Should prefer the upstream bound to the host", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://admin.example.com:8080/api/users", nil)
+		rr := httptest.NewRecorder()
+
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, "admin", rr.Header().Get("X-Upstream"))
+	})
+
+	t.Run("Should forward the limit headers set by the middleware", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-RateLimit-Limit", "1000000")
+		rr := httptest.NewRecorder()
+		rr.Header().Set("X-RateLimit-Limit", "10")
+
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, "web", rr.Header().Get("X-Upstream"))
+		assert.Equal(t, "10", rr.Header().Get("X-Seen-Limit"))
+	})
+}
+
+func TestProxyNoMatch(t *testing.T) {
+	p, err := NewProxy([]Upstream{
+		{Name: "api", URL: "http://127.0.0.1:1", PathPrefix: "/api"},
+	}, http.DefaultClient, time.Second, discardLogger())
+	require.NoError(t, err)
+
+	t.Run("Should return 404 when no upstream matches", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/other", nil)
+		rr := httptest.NewRecorder()
+
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Should return 502 when the upstream fails", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		rr := httptest.NewRecorder()
+
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		assert.JSONEq(t, `{"message":"Upstream request failed"}`, rr.Body.String())
+	})
+}
+
+func TestProxyHealthChecks(t *testing.T) {
+	healthy := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy([]Upstream{
+		{Name: "api", URL: upstream.URL, HealthPath: "/health"},
+	}, upstream.Client(), time.Second, discardLogger())
+	require.NoError(t, err)
+
+	t.Run("Should stay ready while the upstream is healthy", func(t *testing.T) {
+		p.checkAll(context.Background())
+
+		assert.NoError(t, p.Ready(context.Background()))
+	})
+
+	t.Run("Should stop forwarding to an unhealthy upstream", func(t *testing.T) {
+		healthy = false
+		p.checkAll(context.Background())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Error(t, p.Ready(context.Background()))
+	})
+}
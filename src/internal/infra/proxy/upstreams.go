@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type Upstream struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Host       string `json:"host"`
+	PathPrefix string `json:"path_prefix"`
+	HealthPath string `json:"health_path"`
+}
+
+type UpstreamsFile struct {
+	Upstreams []Upstream `json:"upstreams"`
+}
+
+func LoadUpstreams(path string) ([]Upstream, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file UpstreamsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	if len(file.Upstreams) == 0 {
+		return nil, fmt.Errorf("no upstream in %s", path)
+	}
+
+	names := make(map[string]bool, len(file.Upstreams))
+	for _, upstream := range file.Upstreams {
+		if upstream.Name == "" {
+			return nil, fmt.Errorf("upstream without name")
+		}
+		if names[upstream.Name] {
+			return nil, fmt.Errorf("duplicated upstream name %q", upstream.Name)
+		}
+		names[upstream.Name] = true
+
+		if _, err := parseURL(upstream.URL); err != nil {
+			return nil, fmt.Errorf("upstream %q: %w", upstream.Name, err)
+		}
+	}
+
+	return file.Upstreams, nil
+}
+
+// Matches reports whether the upstream serves the request host and path. An
+// empty host or prefix matches any.
+func (u *Upstream) Matches(r *http.Request) bool {
+	if u.Host != "" && !strings.EqualFold(u.Host, requestHost(r)) {
+		return false
+	}
+
+	return strings.HasPrefix(r.URL.Path, u.PathPrefix)
+}
+
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+	return host
+}
+
+func parseURL(raw string) (*url.URL, error) {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", raw)
+	}
+	return target, nil
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeUpstreams(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "upstreams.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadUpstreams(t *testing.T) {
+	t.Run("Should load the upstreams", func(t *testing.T) {
+		path := writeUpstreams(t, `{"upstreams":[{"name":"api","url":"http://api:8080","path_prefix":"/api","health_path":"/health"}]}`)
+
+		upstreams, err := LoadUpstreams(path)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Upstream{{Name: "api", URL: "http://api:8080", PathPrefix: "/api", HealthPath: "/health"}}, upstreams)
+	})
+
+	t.Run("Should reject duplicated names", func(t *testing.T) {
+		path := writeUpstreams(t, `{"upstreams":[{"name":"api","url":"http://a"},{"name":"api","url":"http://b"}]}`)
+
+		_, err := LoadUpstreams(path)
+
+		assert.ErrorContains(t, err, "duplicated upstream name")
+	})
+
+	t.Run("Should reject invalid urls", func(t *testing.T) {
+		path := writeUpstreams(t, `{"upstreams":[{"name":"api","url":"api:8080"}]}`)
+
+		_, err := LoadUpstreams(path)
+
+		assert.ErrorContains(t, err, "invalid url")
+	})
+
+	t.Run("Should reject an empty file", func(t *testing.T) {
+		path := writeUpstreams(t, `{"upstreams":[]}`)
+
+		_, err := LoadUpstreams(path)
+
+		assert.ErrorContains(t, err, "no upstream")
+	})
+}
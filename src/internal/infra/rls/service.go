@@ -0,0 +1,178 @@
+package rls
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+var unitWindows = map[typev3.RateLimitUnit]time.Duration{
+	typev3.RateLimitUnit_SECOND: time.Second,
+	typev3.RateLimitUnit_MINUTE: time.Minute,
+	typev3.RateLimitUnit_HOUR:   time.Hour,
+	typev3.RateLimitUnit_DAY:    24 * time.Hour,
+}
+
+var windowUnits = map[time.Duration]rlsv3.RateLimitResponse_RateLimit_Unit{
+	time.Second:    rlsv3.RateLimitResponse_RateLimit_SECOND,
+	time.Minute:    rlsv3.RateLimitResponse_RateLimit_MINUTE,
+	time.Hour:      rlsv3.RateLimitResponse_RateLimit_HOUR,
+	24 * time.Hour: rlsv3.RateLimitResponse_RateLimit_DAY,
+}
+
+// Service implements Envoy's rate limit service on top of the descriptor
+// rules. Descriptors without a matching rule are not limited.
+type Service struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+	Limiter ratelimiter.RateLimiterInterface
+	Metrics *metrics.Metrics
+	Logger  *slog.Logger
+	Now     func() time.Time
+}
+
+func NewService(
+	limiter ratelimiter.RateLimiterInterface,
+	metrics *metrics.Metrics,
+	logger *slog.Logger,
+	now func() time.Time,
+) *Service {
+	return &Service{
+		Limiter: limiter,
+		Metrics: metrics,
+		Logger:  logger,
+		Now:     now,
+	}
+}
+
+func (s *Service) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	if req.GetDomain() == "" {
+		return nil, status.Error(codes.InvalidArgument, "domain is required")
+	}
+
+	response := &rlsv3.RateLimitResponse{OverallCode: rlsv3.RateLimitResponse_OK}
+
+	for _, descriptor := range req.GetDescriptors() {
+		result, err := s.Limiter.Check(ctx, toDescriptor(req.GetDomain(), descriptor, req.GetHitsAddend()))
+		if errors.Is(err, ratelimiter.ErrNoMatchingRule) {
+			response.Statuses = append(response.Statuses, &rlsv3.RateLimitResponse_DescriptorStatus{
+				Code: rlsv3.RateLimitResponse_OK,
+			})
+			continue
+		}
+		if err != nil {
+			s.Logger.ErrorContext(ctx, "rate limiter check failed", "domain", req.GetDomain(), "error", err)
+			s.Metrics.RecordDecision(metrics.UnknownLabel, ratelimiter.KeyTypeDescriptor, metrics.DecisionErrored)
+			return nil, status.Error(codes.Unavailable, "rate limit check failed")
+		}
+
+		for _, shadow := range result.Shadows {
+			if shadow.Result == strategies.Deny {
+				s.Metrics.RecordDecision(shadow.Rule, shadow.KeyType, metrics.DecisionShadowDenied)
+			}
+		}
+
+		descriptorStatus := s.toStatus(result)
+		if result.Result == strategies.Deny {
+			s.Metrics.RecordDecision(result.Rule, result.KeyType, metrics.DecisionDenied)
+			response.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		} else {
+			s.Metrics.RecordDecision(result.Rule, result.KeyType, metrics.DecisionAllowed)
+		}
+		response.Statuses = append(response.Statuses, descriptorStatus)
+	}
+
+	return response, nil
+}
+
+// Serve answers gRPC requests until the context is done, then stops
+// gracefully.
+func (s *Service) Serve(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(server, s)
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	s.Logger.Info("starting rate limit service", "addr", listener.Addr().String())
+	return server.Serve(listener)
+}
+
+func (s *Service) toStatus(result *strategies.LimitResponse) *rlsv3.RateLimitResponse_DescriptorStatus {
+	code := rlsv3.RateLimitResponse_OK
+	if result.Result == strategies.Deny {
+		code = rlsv3.RateLimitResponse_OVER_LIMIT
+	}
+
+	untilReset := result.ExpiresAt.Sub(s.Now())
+	if untilReset < 0 {
+		untilReset = 0
+	}
+
+	return &rlsv3.RateLimitResponse_DescriptorStatus{
+		Code: code,
+		CurrentLimit: &rlsv3.RateLimitResponse_RateLimit{
+			Name:            result.Rule,
+			RequestsPerUnit: clampUint32(result.Limit),
+			Unit:            windowUnit(result.Request),
+		},
+		LimitRemaining:     clampUint32(result.Remaining),
+		DurationUntilReset: durationpb.New(untilReset),
+	}
+}
+
+// clampUint32 fits counts into the 32 bits of the Envoy API, which limits such
+// as monthly quotas can exceed.
+func clampUint32(n int64) uint32 {
+	return uint32(min(max(n, 0), math.MaxUint32))
+}
+
+// windowUnit is the Envoy unit of the counted window, UNKNOWN when the window
+// is not exactly one unit long. Calendar periods count down to their end, so
+// their request duration is not a unit either.
+func windowUnit(request *strategies.Request) rlsv3.RateLimitResponse_RateLimit_Unit {
+	if request == nil || !request.ResetAt.IsZero() {
+		return rlsv3.RateLimitResponse_RateLimit_UNKNOWN
+	}
+	if unit, ok := windowUnits[request.Duration]; ok {
+		return unit
+	}
+	return rlsv3.RateLimitResponse_RateLimit_UNKNOWN
+}
+
+// toDescriptor maps an Envoy descriptor, honoring its limit override when the
+// unit is supported. hitsAddend is the cost, zero meaning one hit.
+func toDescriptor(domain string, descriptor *ratelimitv3.RateLimitDescriptor, hitsAddend uint32) ratelimiter.Descriptor {
+	result := ratelimiter.Descriptor{Domain: domain, Cost: int64(hitsAddend)}
+	for _, entry := range descriptor.GetEntries() {
+		result.Entries = append(result.Entries, ratelimiter.DescriptorEntry{
+			Key:   entry.GetKey(),
+			Value: entry.GetValue(),
+		})
+	}
+
+	if override := descriptor.GetLimit(); override != nil {
+		if window, ok := unitWindows[override.GetUnit()]; ok && override.GetRequestsPerUnit() > 0 {
+			result.Limit = int64(override.GetRequestsPerUnit())
+			result.Window = window
+		}
+	}
+
+	return result
+}
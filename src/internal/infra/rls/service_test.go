@@ -0,0 +1,270 @@
+package rls
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+}
+
+type RateLimiterMock struct {
+	mock.Mock
+}
+
+func (m *RateLimiterMock) Check(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *RateLimiterMock) Refund(ctx context.Context, result *strategies.LimitResponse) error {
+	args := m.Called(ctx, result)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) Peek(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+// newClient serves the service in-process and returns a client connected to it.
+func newClient(t *testing.T, limiter ratelimiter.RateLimiterInterface) rlsv3.RateLimitServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	service := NewService(limiter, metrics.NewMetrics(), discardLogger(), mockNow)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go service.Serve(ctx, listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return rlsv3.NewRateLimitServiceClient(conn)
+}
+
+func descriptor(entries ...string) *ratelimitv3.RateLimitDescriptor {
+	d := &ratelimitv3.RateLimitDescriptor{}
+	for i := 0; i < len(entries); i += 2 {
+		d.Entries = append(d.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: entries[i], Value: entries[i+1]})
+	}
+	return d
+}
+
+func TestServiceShouldRateLimit(t *testing.T) {
+	t.Run("Should return a status per descriptor", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Domain:  "edge",
+			Entries: []ratelimiter.DescriptorEntry{{Key: "user", Value: "alice"}},
+		}).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Rule:      "per-user",
+			Limit:     10,
+			Remaining: 7,
+			ExpiresAt: mockNow().Add(30 * time.Second),
+		}, nil)
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Domain:  "edge",
+			Entries: []ratelimiter.DescriptorEntry{{Key: "path", Value: "/checkout"}},
+		}).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Rule:      "checkout",
+			Limit:     5,
+			Remaining: 0,
+			ExpiresAt: mockNow().Add(10 * time.Second),
+		}, nil)
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Domain:  "edge",
+			Entries: []ratelimiter.DescriptorEntry{{Key: "other", Value: "x"}},
+		}).Return(nil, ratelimiter.ErrNoMatchingRule)
+
+		response, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+			Domain: "edge",
+			Descriptors: []*ratelimitv3.RateLimitDescriptor{
+				descriptor("user", "alice"),
+				descriptor("path", "/checkout"),
+				descriptor("other", "x"),
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, rlsv3.RateLimitResponse_OVER_LIMIT, response.OverallCode)
+		require.Len(t, response.Statuses, 3)
+
+		assert.Equal(t, rlsv3.RateLimitResponse_OK, response.Statuses[0].Code)
+		assert.Equal(t, uint32(10), response.Statuses[0].CurrentLimit.RequestsPerUnit)
+		assert.Equal(t, "per-user", response.Statuses[0].CurrentLimit.Name)
+		assert.Equal(t, uint32(7), response.Statuses[0].LimitRemaining)
+		assert.Equal(t, 30*time.Second, response.Statuses[0].DurationUntilReset.AsDuration())
+
+		assert.Equal(t, rlsv3.RateLimitResponse_OVER_LIMIT, response.Statuses[1].Code)
+		assert.Equal(t, uint32(0), response.Statuses[1].LimitRemaining)
+
+		assert.Equal(t, rlsv3.RateLimitResponse_OK, response.Statuses[2].Code)
+		assert.Nil(t, response.Statuses[2].CurrentLimit)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should apply the descriptor limit override", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Domain:  "edge",
+			Entries: []ratelimiter.DescriptorEntry{{Key: "user", Value: "bob"}},
+			Limit:   100,
+			Window:  time.Minute,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 100, ExpiresAt: mockNow()}, nil)
+
+		d := descriptor("user", "bob")
+		d.Limit = &ratelimitv3.RateLimitDescriptor_RateLimitOverride{RequestsPerUnit: 100, Unit: typev3.RateLimitUnit_MINUTE}
+
+		response, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+			Domain:      "edge",
+			Descriptors: []*ratelimitv3.RateLimitDescriptor{d},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, rlsv3.RateLimitResponse_OK, response.OverallCode)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should use hits_addend as the cost", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Domain:  "edge",
+			Entries: []ratelimiter.DescriptorEntry{{Key: "user", Value: "bob"}},
+			Cost:    25,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 100, ExpiresAt: mockNow()}, nil)
+
+		_, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+			Domain:      "edge",
+			Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("user", "bob")},
+			HitsAddend:  25,
+		})
+
+		require.NoError(t, err)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should clamp limits that do not fit in 32 bits", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     math.MaxUint32 + 10,
+			Remaining: math.MaxUint32 + 5,
+			ExpiresAt: mockNow(),
+		}, nil)
+
+		response, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+			Domain:      "edge",
+			Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("user", "alice")},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, uint32(math.MaxUint32), response.Statuses[0].CurrentLimit.RequestsPerUnit)
+		assert.Equal(t, uint32(math.MaxUint32), response.Statuses[0].LimitRemaining)
+	})
+
+	t.Run("Should report the unit of the rule window", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newClient(t, limiter)
+
+		windows := []struct {
+			request *strategies.Request
+			unit    rlsv3.RateLimitResponse_RateLimit_Unit
+		}{
+			{&strategies.Request{Duration: time.Second}, rlsv3.RateLimitResponse_RateLimit_SECOND},
+			{&strategies.Request{Duration: time.Minute}, rlsv3.RateLimitResponse_RateLimit_MINUTE},
+			{&strategies.Request{Duration: time.Hour}, rlsv3.RateLimitResponse_RateLimit_HOUR},
+			{&strategies.Request{Duration: 24 * time.Hour}, rlsv3.RateLimitResponse_RateLimit_DAY},
+			{&strategies.Request{Duration: 30 * time.Second}, rlsv3.RateLimitResponse_RateLimit_UNKNOWN},
+			{&strategies.Request{Duration: 24 * time.Hour, ResetAt: mockNow().Add(24 * time.Hour)}, rlsv3.RateLimitResponse_RateLimit_UNKNOWN},
+			{nil, rlsv3.RateLimitResponse_RateLimit_UNKNOWN},
+		}
+		for _, window := range windows {
+			limiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+				Result:    strategies.Allow,
+				Limit:     10,
+				ExpiresAt: mockNow(),
+				Request:   window.request,
+			}, nil).Once()
+		}
+
+		for _, window := range windows {
+			response, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+				Domain:      "edge",
+				Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("user", "alice")},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, window.unit, response.Statuses[0].CurrentLimit.Unit)
+		}
+	})
+
+	t.Run("Should return Unavailable when the store fails", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, mock.Anything).Return(nil, errors.New("redis unavailable"))
+
+		_, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+			Domain:      "edge",
+			Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("user", "alice")},
+		})
+
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.NotContains(t, err.Error(), "redis")
+	})
+
+	t.Run("Should require a domain", func(t *testing.T) {
+		client := newClient(t, new(RateLimiterMock))
+
+		_, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{})
+
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
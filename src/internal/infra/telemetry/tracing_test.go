@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewExporter(t *testing.T) {
+	t.Run("Should disable tracing by default", func(t *testing.T) {
+		exporter, err := NewExporter(context.Background(), config.Conf{})
+
+		assert.NoError(t, err)
+		assert.Nil(t, exporter)
+	})
+
+	t.Run("Should build the stdout exporter", func(t *testing.T) {
+		exporter, err := NewExporter(context.Background(), config.Conf{TracingExporter: ExporterStdout})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, exporter)
+	})
+
+	t.Run("Should build the OTLP exporter", func(t *testing.T) {
+		exporter, err := NewExporter(context.Background(), config.Conf{
+			TracingExporter:     ExporterOTLP,
+			TracingOTLPEndpoint: "localhost:4318",
+			TracingOTLPInsecure: true,
+		})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, exporter)
+	})
+
+	t.Run("Should reject unknown exporters", func(t *testing.T) {
+		_, err := NewExporter(context.Background(), config.Conf{TracingExporter: "zipkin"})
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,222 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+
+	// MaxReportDays bounds how many daily hashes a report reads.
+	MaxReportDays = 366
+)
+
+var (
+	ErrInvalidGranularity = errors.New("granularity must be hour or day")
+	ErrInvalidRange       = errors.New("from must be before to")
+	ErrRangeTooLong       = fmt.Errorf("reports cover at most %d days", MaxReportDays)
+)
+
+// Bucket counts the requests of a token in the hour or day starting at Start.
+type Bucket struct {
+	Start   time.Time `json:"start"`
+	Allowed int64     `json:"allowed"`
+	Denied  int64     `json:"denied"`
+}
+
+// Query selects the buckets of Token starting in [From, To), with From
+// rounded down to the granularity.
+type Query struct {
+	Token       string
+	From        time.Time
+	To          time.Time
+	Granularity string
+}
+
+type Recorder interface {
+	// Record counts a decision of the limiter for the token.
+	Record(token string, allowed bool)
+}
+
+type Reader interface {
+	Report(ctx context.Context, query Query) ([]Bucket, error)
+}
+
+type NopRecorder struct{}
+
+func (NopRecorder) Record(token string, allowed bool) {}
+
+type counter struct {
+	token   string
+	hour    time.Time
+	allowed bool
+}
+
+// RedisUsage keeps the usage of each token in a hash per UTC day, with an
+// allowed and a denied field per hour, so hashes never exceed 48 fields and
+// expire after Retention. Decisions are counted in memory and flushed every
+// FlushInterval, so requests wait on no round trip.
+type RedisUsage struct {
+	Client        *redis.Client
+	Retention     time.Duration
+	FlushInterval time.Duration
+	Logger        *slog.Logger
+	Now           func() time.Time
+
+	mu      sync.Mutex
+	pending map[counter]int64
+}
+
+func NewRedisUsage(
+	client *redis.Client,
+	retention time.Duration,
+	flushInterval time.Duration,
+	logger *slog.Logger,
+	now func() time.Time,
+) *RedisUsage {
+	return &RedisUsage{
+		Client:        client,
+		Retention:     retention,
+		FlushInterval: flushInterval,
+		Logger:        logger,
+		Now:           now,
+		pending:       make(map[counter]int64),
+	}
+}
+
+func (u *RedisUsage) Record(token string, allowed bool) {
+	key := counter{token: token, hour: u.Now().UTC().Truncate(time.Hour), allowed: allowed}
+
+	u.mu.Lock()
+	u.pending[key]++
+	u.mu.Unlock()
+}
+
+// Run flushes the counts until the context is done, then flushes the last
+// ones.
+func (u *RedisUsage) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			u.flushLogged(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			u.flushLogged(ctx)
+		}
+	}
+}
+
+func (u *RedisUsage) flushLogged(ctx context.Context) {
+	if err := u.Flush(ctx); err != nil {
+		u.Logger.WarnContext(ctx, "usage flush failed, counts kept for the next one", "error", err)
+	}
+}
+
+// Flush writes the pending counts in a transaction, so they are written all
+// or none. Counts that fail to be written are kept for the next flush.
+func (u *RedisUsage) Flush(ctx context.Context) error {
+	u.mu.Lock()
+	pending := u.pending
+	u.pending = make(map[counter]int64)
+	u.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	expiring := make(map[string]bool)
+	p := u.Client.TxPipeline()
+	for c, count := range pending {
+		key := dayKey(c.token, c.hour)
+		p.HIncrBy(ctx, key, hourField(c.hour, c.allowed), count)
+		if !expiring[key] {
+			expiring[key] = true
+			p.Expire(ctx, key, u.Retention)
+		}
+	}
+
+	if _, err := p.Exec(ctx); err != nil {
+		u.mu.Lock()
+		for c, count := range pending {
+			u.pending[c] += count
+		}
+		u.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Report returns every bucket of the query, including the empty ones.
+func (u *RedisUsage) Report(ctx context.Context, query Query) ([]Bucket, error) {
+	step := time.Hour
+	switch query.Granularity {
+	case GranularityHour:
+	case GranularityDay:
+		step = 24 * time.Hour
+	default:
+		return nil, ErrInvalidGranularity
+	}
+
+	from := query.From.UTC().Truncate(step)
+	to := query.To.UTC()
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	firstDay := from.Truncate(24 * time.Hour)
+	days := int(to.Sub(firstDay)/(24*time.Hour)) + 1
+	if days > MaxReportDays {
+		return nil, ErrRangeTooLong
+	}
+
+	p := u.Client.Pipeline()
+	hashes := make([]*redis.MapStringStringCmd, days)
+	for i := range hashes {
+		hashes[i] = p.HGetAll(ctx, dayKey(query.Token, firstDay.AddDate(0, 0, i)))
+	}
+	if _, err := p.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var buckets []Bucket
+	for start := from; start.Before(to); start = start.Add(step) {
+		bucket := Bucket{Start: start}
+		for hour := start; hour.Before(start.Add(step)); hour = hour.Add(time.Hour) {
+			fields := hashes[int(hour.Sub(firstDay)/(24*time.Hour))].Val()
+			bucket.Allowed += parseCount(fields[hourField(hour, true)])
+			bucket.Denied += parseCount(fields[hourField(hour, false)])
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
+
+func dayKey(token string, day time.Time) string {
+	return fmt.Sprintf("usage:%s:%s", token, day.Format("20060102"))
+}
+
+func hourField(hour time.Time, allowed bool) string {
+	if allowed {
+		return hour.Format("15") + ":allowed"
+	}
+	return hour.Format("15") + ":denied"
+}
+
+func parseCount(value string) int64 {
+	count, _ := strconv.ParseInt(value, 10, 64)
+	return count
+}
@@ -0,0 +1,113 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 20, 0, 0, time.UTC)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestRedisUsageFlush(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	usage := NewRedisUsage(db, 90*24*time.Hour, time.Second, discardLogger(), mockNow)
+
+	t.Run("Should add the counts to the hash of the day", func(t *testing.T) {
+		usage.Record("dummy_token", true)
+		usage.Record("dummy_token", true)
+
+		clientMock.ExpectTxPipeline()
+		clientMock.ExpectHIncrBy("usage:dummy_token:20241024", "03:allowed", 2).SetVal(2)
+		clientMock.ExpectExpire("usage:dummy_token:20241024", 90*24*time.Hour).SetVal(true)
+		clientMock.ExpectTxPipelineExec()
+
+		assert.NoError(t, usage.Flush(context.Background()))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should keep the counts that failed to be written", func(t *testing.T) {
+		usage.Record("dummy_token", false)
+
+		clientMock.ExpectTxPipeline()
+		clientMock.ExpectHIncrBy("usage:dummy_token:20241024", "03:denied", 1).SetErr(errors.New("connection refused"))
+		assert.Error(t, usage.Flush(context.Background()))
+		clientMock.ClearExpect()
+
+		usage.Record("dummy_token", false)
+
+		clientMock.ExpectTxPipeline()
+		clientMock.ExpectHIncrBy("usage:dummy_token:20241024", "03:denied", 2).SetVal(2)
+		clientMock.ExpectExpire("usage:dummy_token:20241024", 90*24*time.Hour).SetVal(true)
+		clientMock.ExpectTxPipelineExec()
+
+		assert.NoError(t, usage.Flush(context.Background()))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should write nothing without counts", func(t *testing.T) {
+		assert.NoError(t, usage.Flush(context.Background()))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
+
+func TestRedisUsageReport(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	usage := NewRedisUsage(db, 90*24*time.Hour, time.Second, discardLogger(), mockNow)
+
+	t.Run("Should return the hourly buckets of the range", func(t *testing.T) {
+		clientMock.ExpectHGetAll("usage:dummy_token:20241024").SetVal(map[string]string{"03:allowed": "10", "03:denied": "2", "05:allowed": "1"})
+
+		buckets, err := usage.Report(context.Background(), Query{
+			Token:       "dummy_token",
+			From:        time.Date(2024, 10, 24, 3, 30, 0, 0, time.UTC),
+			To:          time.Date(2024, 10, 24, 5, 0, 0, 0, time.UTC),
+			Granularity: GranularityHour,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Bucket{
+			{Start: time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC), Allowed: 10, Denied: 2},
+			{Start: time.Date(2024, 10, 24, 4, 0, 0, 0, time.UTC)},
+		}, buckets)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should sum the hours of each day", func(t *testing.T) {
+		clientMock.ExpectHGetAll("usage:dummy_token:20241023").SetVal(map[string]string{"00:allowed": "4", "23:denied": "1"})
+		clientMock.ExpectHGetAll("usage:dummy_token:20241024").SetVal(map[string]string{"03:allowed": "10"})
+
+		buckets, err := usage.Report(context.Background(), Query{
+			Token:       "dummy_token",
+			From:        time.Date(2024, 10, 23, 0, 0, 0, 0, time.UTC),
+			To:          time.Date(2024, 10, 24, 12, 0, 0, 0, time.UTC),
+			Granularity: GranularityDay,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Bucket{
+			{Start: time.Date(2024, 10, 23, 0, 0, 0, 0, time.UTC), Allowed: 4, Denied: 1},
+			{Start: time.Date(2024, 10, 24, 0, 0, 0, 0, time.UTC), Allowed: 10},
+		}, buckets)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should reject long ranges and unknown granularities", func(t *testing.T) {
+		_, err := usage.Report(context.Background(), Query{Token: "dummy_token", From: mockNow().AddDate(-2, 0, 0), To: mockNow(), Granularity: GranularityDay})
+		assert.ErrorIs(t, err, ErrRangeTooLong)
+
+		_, err = usage.Report(context.Background(), Query{Token: "dummy_token", From: mockNow().Add(-time.Hour), To: mockNow(), Granularity: "week"})
+		assert.ErrorIs(t, err, ErrInvalidGranularity)
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
+)
+
+const defaultAuditLimit = 100
+
+type AuditHandler struct {
+	Reader audit.Reader
+	Logger *slog.Logger
+}
+
+func NewAuditHandler(reader audit.Reader, logger *slog.Logger) *AuditHandler {
+	return &AuditHandler{
+		Reader: reader,
+		Logger: logger,
+	}
+}
+
+// List returns the audit entries filtered by the from and to (RFC 3339),
+// actor and limit query parameters.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := audit.Query{
+		Actor: params.Get("actor"),
+		Limit: defaultAuditLimit,
+	}
+
+	var err error
+	if from := params.Get("from"); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			writeBadRequest(w, "Invalid from")
+			return
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			writeBadRequest(w, "Invalid to")
+			return
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			writeBadRequest(w, "Invalid limit")
+			return
+		}
+	}
+
+	entries, err := h.Reader.Query(r.Context(), query)
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "unable to query audit log", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Unable to read the audit log",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func writeBadRequest(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: message,
+	})
+}
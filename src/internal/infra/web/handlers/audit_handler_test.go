@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAuditReader struct {
+	query   audit.Query
+	entries []audit.Entry
+	err     error
+}
+
+func (f *fakeAuditReader) Query(ctx context.Context, query audit.Query) ([]audit.Entry, error) {
+	f.query = query
+	return f.entries, f.err
+}
+
+func TestAuditHandlerList(t *testing.T) {
+	t.Run("Should pass the filters and return the entries", func(t *testing.T) {
+		reader := &fakeAuditReader{entries: []audit.Entry{
+			{ID: "1-0", Time: time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC), Actor: "alice", Action: audit.ActionTokenCreate, Target: "abc", After: "10"},
+		}}
+		handler := NewAuditHandler(reader, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?from=2024-10-24T00:00:00Z&to=2024-10-25T00:00:00Z&actor=alice&limit=5", nil)
+		rr := httptest.NewRecorder()
+
+		handler.List(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, audit.Query{
+			From:  time.Date(2024, 10, 24, 0, 0, 0, 0, time.UTC),
+			To:    time.Date(2024, 10, 25, 0, 0, 0, 0, time.UTC),
+			Actor: "alice",
+			Limit: 5,
+		}, reader.query)
+		assert.JSONEq(t, `[{"id":"1-0","time":"2024-10-24T03:00:00Z","actor":"alice","action":"token.create","target":"abc","after":"10"}]`, rr.Body.String())
+	})
+
+	t.Run("Should reject invalid filters", func(t *testing.T) {
+		handler := NewAuditHandler(&fakeAuditReader{}, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?from=yesterday", nil)
+		rr := httptest.NewRecorder()
+
+		handler.List(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"message":"Invalid from"}`, rr.Body.String())
+	})
+
+	t.Run("Should not leak store errors", func(t *testing.T) {
+		handler := NewAuditHandler(&fakeAuditReader{err: errors.New("redis unavailable")}, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+		rr := httptest.NewRecorder()
+
+		handler.List(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.JSONEq(t, `{"message":"Unable to read the audit log"}`, rr.Body.String())
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+// CounterHandler lets support reset or adjust the counter of a key, or grant
+// it a temporary bonus. Every change is audited.
+type CounterHandler struct {
+	Limiter ratelimiter.CounterAdminInterface
+	Logger  *slog.Logger
+	Audit   audit.Recorder
+}
+
+func NewCounterHandler(
+	limiter ratelimiter.CounterAdminInterface,
+	logger *slog.Logger,
+	auditRecorder audit.Recorder,
+) *CounterHandler {
+	return &CounterHandler{
+		Limiter: limiter,
+		Logger:  logger,
+		Audit:   auditRecorder,
+	}
+}
+
+// CounterRequest names the key by ip or api_key and the route by method and
+// path (GET / by default).
+type CounterRequest struct {
+	IP     string `json:"ip"`
+	APIKey string `json:"api_key"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Used   *int64 `json:"used"`
+	Bonus  int64  `json:"bonus"`
+	TTL    string `json:"ttl"`
+}
+
+func (h *CounterHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	_, descriptor, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+
+	h.apply(w, r, descriptor, audit.ActionCounterReset, "used=0", func() error {
+		return h.Limiter.Reset(r.Context(), descriptor)
+	})
+}
+
+func (h *CounterHandler) SetUsage(w http.ResponseWriter, r *http.Request) {
+	dto, descriptor, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if dto.Used == nil || *dto.Used < 0 {
+		writeBadRequest(w, "Invalid used")
+		return
+	}
+
+	h.apply(w, r, descriptor, audit.ActionCounterSet, "used="+strconv.FormatInt(*dto.Used, 10), func() error {
+		return h.Limiter.SetUsage(r.Context(), descriptor, *dto.Used)
+	})
+}
+
+func (h *CounterHandler) Grant(w http.ResponseWriter, r *http.Request) {
+	dto, descriptor, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	ttl, err := time.ParseDuration(dto.TTL)
+	if dto.Bonus <= 0 || err != nil || ttl <= 0 {
+		writeBadRequest(w, "Invalid bonus or ttl")
+		return
+	}
+
+	h.apply(w, r, descriptor, audit.ActionCounterBonus, fmt.Sprintf("bonus=%d ttl=%s", dto.Bonus, ttl), func() error {
+		return h.Limiter.Grant(r.Context(), descriptor, dto.Bonus, ttl)
+	})
+}
+
+func (h *CounterHandler) decode(w http.ResponseWriter, r *http.Request) (CounterRequest, ratelimiter.Descriptor, bool) {
+	var dto CounterRequest
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		writeBadRequest(w, "Unable to read the body")
+		return dto, ratelimiter.Descriptor{}, false
+	}
+	if dto.IP == "" && dto.APIKey == "" {
+		writeBadRequest(w, "ip or api_key is required")
+		return dto, ratelimiter.Descriptor{}, false
+	}
+
+	descriptor := ratelimiter.Descriptor{
+		Method:   http.MethodGet,
+		Path:     "/",
+		ClientIP: dto.IP,
+		APIKey:   dto.APIKey,
+	}
+	if dto.Method != "" {
+		descriptor.Method = dto.Method
+	}
+	if dto.Path != "" {
+		descriptor.Path = dto.Path
+	}
+
+	return dto, descriptor, true
+}
+
+// apply runs the change between two peeks, so the audit entry and the
+// response carry the state before and after it. An api_key that is not
+// registered, given without an ip, is not found rather than changing the
+// counter of an empty IP.
+func (h *CounterHandler) apply(w http.ResponseWriter, r *http.Request, descriptor ratelimiter.Descriptor, action string, after string, change func() error) {
+	before, err := h.Limiter.Peek(r.Context(), descriptor)
+	if err == nil && descriptor.ClientIP == "" && before.KeyType != ratelimiter.KeyTypeToken {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Token not found",
+		})
+		return
+	}
+	if err == nil {
+		err = change()
+	}
+	var current *strategies.LimitResponse
+	if err == nil {
+		current, err = h.Limiter.Peek(r.Context(), descriptor)
+	}
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "unable to change rate limit counter", "action", action, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Unable to change the counter",
+		})
+		return
+	}
+
+	h.Logger.InfoContext(r.Context(), "rate limit counter changed", "action", action, "rule", current.Rule, "key_hash", logging.HashKey(current.Key))
+	recordAudit(r, h.Audit, h.Logger, audit.Entry{
+		Action: action,
+		Target: audit.CounterTarget(current.Rule, current.KeyType, logging.HashKey(current.Key)),
+		Before: fmt.Sprintf("used=%d limit=%d", before.Total, before.Limit),
+		After:  after,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newStatusResponse(current))
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCounterHandler(t *testing.T) {
+	descriptor := ratelimiter.Descriptor{Method: http.MethodPost, Path: "/export", APIKey: "abc"}
+	state := func(used int64, limit int64) *strategies.LimitResponse {
+		return &strategies.LimitResponse{
+			Rule:      "export",
+			Key:       "abc",
+			KeyType:   ratelimiter.KeyTypeToken,
+			Limit:     limit,
+			Total:     used,
+			Remaining: limit - used,
+			ExpiresAt: time.Date(2024, 10, 24, 3, 1, 0, 0, time.UTC),
+		}
+	}
+
+	t.Run("Should reset the counter and audit the change", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		auditor := &recordingAuditor{}
+		handler := NewCounterHandler(limiter, discardLogger(), auditor)
+
+		limiter.On("Peek", mock.Anything, descriptor).Return(state(10, 10), nil).Once()
+		limiter.On("Reset", mock.Anything, descriptor).Return(nil)
+		limiter.On("Peek", mock.Anything, descriptor).Return(state(0, 10), nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/ratelimit/reset", bytes.NewBufferString(`{"api_key":"abc","method":"POST","path":"/export"}`))
+		req.Header.Set(ActorHeader, "support")
+		rr := httptest.NewRecorder()
+
+		handler.Reset(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"rule":"export","key_type":"token","limit":10,"used":0,"remaining":10,"reset":1729738860}`, rr.Body.String())
+		assert.Equal(t, []audit.Entry{
+			{
+				Actor:  "support",
+				Source: "ip:192.0.2.1",
+				Action: audit.ActionCounterReset,
+				Target: "export:token:" + logging.HashKey("abc"),
+				Before: "used=10 limit=10",
+				After:  "used=0",
+			},
+		}, auditor.entries)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should set the usage", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		handler := NewCounterHandler(limiter, discardLogger(), &recordingAuditor{})
+
+		limiter.On("Peek", mock.Anything, descriptor).Return(state(8, 10), nil)
+		limiter.On("SetUsage", mock.Anything, descriptor, int64(2)).Return(nil)
+
+		req := httptest.NewRequest(http.MethodPut, "/admin/ratelimit/usage", bytes.NewBufferString(`{"api_key":"abc","method":"POST","path":"/export","used":2}`))
+		rr := httptest.NewRecorder()
+
+		handler.SetUsage(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should grant an expiring bonus", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		auditor := &recordingAuditor{}
+		handler := NewCounterHandler(limiter, discardLogger(), auditor)
+
+		limiter.On("Peek", mock.Anything, descriptor).Return(state(10, 10), nil).Once()
+		limiter.On("Grant", mock.Anything, descriptor, int64(50), time.Hour).Return(nil)
+		limiter.On("Peek", mock.Anything, descriptor).Return(state(10, 60), nil).Once()
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/ratelimit/bonus", bytes.NewBufferString(`{"api_key":"abc","method":"POST","path":"/export","bonus":50,"ttl":"1h"}`))
+		rr := httptest.NewRecorder()
+
+		handler.Grant(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "bonus=50 ttl=1h0m0s", auditor.entries[0].After)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should validate the body", func(t *testing.T) {
+		handler := NewCounterHandler(new(RateLimiterMock), discardLogger(), &recordingAuditor{})
+
+		for _, body := range []string{`{}`, `{"ip":"203.0.113.7","bonus":5}`} {
+			rr := httptest.NewRecorder()
+			handler.Grant(rr, httptest.NewRequest(http.MethodPost, "/admin/ratelimit/bonus", bytes.NewBufferString(body)))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.SetUsage(rr, httptest.NewRequest(http.MethodPut, "/admin/ratelimit/usage", bytes.NewBufferString(`{"ip":"203.0.113.7"}`)))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Should not find tokens that are not registered", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		auditor := &recordingAuditor{}
+		handler := NewCounterHandler(limiter, discardLogger(), auditor)
+
+		limiter.On("Peek", mock.Anything, ratelimiter.Descriptor{Method: http.MethodGet, Path: "/", APIKey: "unknown"}).
+			Return(&strategies.LimitResponse{Rule: "default", KeyType: ratelimiter.KeyTypeIP, Limit: 10, Total: 3}, nil)
+
+		rr := httptest.NewRecorder()
+		handler.Reset(rr, httptest.NewRequest(http.MethodPost, "/admin/ratelimit/reset", bytes.NewBufferString(`{"api_key":"unknown"}`)))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		limiter.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+		assert.Empty(t, auditor.entries)
+	})
+
+	t.Run("Should not audit failed changes", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		auditor := &recordingAuditor{}
+		handler := NewCounterHandler(limiter, discardLogger(), auditor)
+
+		limiter.On("Peek", mock.Anything, mock.Anything).Return(state(1, 10), nil)
+		limiter.On("Reset", mock.Anything, mock.Anything).Return(errors.New("redis down"))
+
+		rr := httptest.NewRecorder()
+		handler.Reset(rr, httptest.NewRequest(http.MethodPost, "/admin/ratelimit/reset", bytes.NewBufferString(`{"ip":"203.0.113.7"}`)))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "redis")
+		assert.Empty(t, auditor.entries)
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+)
+
+type EventsHandler struct {
+	Subscriber events.Subscriber
+	Heartbeat  time.Duration
+	Logger     *slog.Logger
+	closing    chan struct{}
+	closeOnce  sync.Once
+}
+
+func NewEventsHandler(subscriber events.Subscriber, heartbeat time.Duration, logger *slog.Logger) *EventsHandler {
+	return &EventsHandler{
+		Subscriber: subscriber,
+		Heartbeat:  heartbeat,
+		Logger:     logger,
+		closing:    make(chan struct{}),
+	}
+}
+
+// Close ends the open streams, letting the server drain.
+func (h *EventsHandler) Close() {
+	h.closeOnce.Do(func() { close(h.closing) })
+}
+
+// Stream sends the limiter events of the whole fleet as Server-Sent Events,
+// filtered by the type, rule, key_type and decision query parameters.
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Streaming unsupported",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := events.ParseFilter(query.Get("type"), query.Get("rule"), query.Get("key_type"), query.Get("decision"))
+
+	stream, err := h.Subscriber.Subscribe(r.Context())
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "unable to subscribe to events", "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Unable to subscribe to events",
+		})
+		return
+	}
+
+	// streams outlive the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.closing:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			if !filter.Matches(event) {
+				continue
+			}
+
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
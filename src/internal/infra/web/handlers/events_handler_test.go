@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSubscriber struct {
+	events []events.Event
+	err    error
+}
+
+func (f *fakeSubscriber) Subscribe(ctx context.Context) (<-chan events.Event, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	stream := make(chan events.Event, len(f.events))
+	for _, event := range f.events {
+		stream <- event
+	}
+	close(stream)
+
+	return stream, nil
+}
+
+func TestEventsHandlerStream(t *testing.T) {
+	eventTime := time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+
+	t.Run("Should stream the filtered events", func(t *testing.T) {
+		subscriber := &fakeSubscriber{events: []events.Event{
+			{Type: events.TypeDecision, Time: eventTime, Decision: events.DecisionDenied, Rule: "default", KeyType: "ip"},
+			{Type: events.TypeDecision, Time: eventTime, Decision: events.DecisionDenied, Rule: "export", KeyType: "ip"},
+			{Type: events.TypeTokenChange, Time: eventTime, KeyType: "token"},
+		}}
+		handler := NewEventsHandler(subscriber, time.Minute, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/events?rule=default", nil)
+		rr := httptest.NewRecorder()
+
+		handler.Stream(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+		assert.Equal(t,
+			"event: decision\ndata: {\"type\":\"decision\",\"time\":\"2024-10-24T03:00:00Z\",\"instance\":\"\",\"decision\":\"denied\",\"rule\":\"default\",\"key_type\":\"ip\"}\n\n",
+			rr.Body.String(),
+		)
+	})
+
+	t.Run("Should answer 503 when unable to subscribe", func(t *testing.T) {
+		handler := NewEventsHandler(&fakeSubscriber{err: errors.New("redis unavailable")}, time.Minute, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/events", nil)
+		rr := httptest.NewRecorder()
+
+		handler.Stream(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.JSONEq(t, `{"message":"Unable to subscribe to events"}`, rr.Body.String())
+	})
+}
+
+func TestEventsHandlerClose(t *testing.T) {
+	handler := NewEventsHandler(&blockingSubscriber{}, time.Minute, discardLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/events", nil)
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.Stream(rr, req)
+		close(done)
+	}()
+
+	handler.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not end after Close")
+	}
+}
+
+type blockingSubscriber struct{}
+
+func (b *blockingSubscriber) Subscribe(ctx context.Context) (<-chan events.Event, error) {
+	return make(chan events.Event), nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type ComponentStatus struct {
+	Status string `json:"status"`
+}
+
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+type HealthHandler struct {
+	Checks   []HealthCheck
+	Timeout  time.Duration
+	Logger   *slog.Logger
+	draining atomic.Bool
+}
+
+func NewHealthHandler(checks []HealthCheck, timeout time.Duration, logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		Checks:  checks,
+		Timeout: timeout,
+		Logger:  logger,
+	}
+}
+
+// Drain makes the readiness fail from now on, while the server drains.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is up and serving.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthResponse{Status: StatusOK})
+}
+
+// Ready reports whether the instance can take traffic, with the status of
+// each component. Check errors are only logged.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	response := HealthResponse{
+		Status:     StatusOK,
+		Components: make(map[string]ComponentStatus, len(h.Checks)+1),
+	}
+
+	for _, check := range h.Checks {
+		status := StatusOK
+		if err := check.Check(ctx); err != nil {
+			h.Logger.WarnContext(ctx, "readiness check failed", "component", check.Name, "error", err)
+			status = StatusUnavailable
+			response.Status = StatusUnavailable
+		}
+		response.Components[check.Name] = ComponentStatus{Status: status}
+	}
+
+	shutdown := StatusOK
+	if h.draining.Load() {
+		shutdown = StatusDraining
+		response.Status = StatusUnavailable
+	}
+	response.Components["shutdown"] = ComponentStatus{Status: shutdown}
+
+	code := http.StatusOK
+	if response.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, response)
+}
+
+func writeHealth(w http.ResponseWriter, code int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func passingCheck(ctx context.Context) error {
+	return nil
+}
+
+func TestHealthHandlerLive(t *testing.T) {
+	handler := NewHealthHandler(nil, time.Second, discardLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rr := httptest.NewRecorder()
+
+	handler.Live(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestHealthHandlerReady(t *testing.T) {
+	t.Run("Should be ready when every component is up", func(t *testing.T) {
+		handler := NewHealthHandler([]HealthCheck{
+			{Name: "redis", Check: passingCheck},
+			{Name: "config", Check: passingCheck},
+		}, time.Second, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rr := httptest.NewRecorder()
+
+		handler.Ready(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"status":"ok","components":{"redis":{"status":"ok"},"config":{"status":"ok"},"shutdown":{"status":"ok"}}}`, rr.Body.String())
+	})
+
+	t.Run("Should not be ready when a component is down", func(t *testing.T) {
+		handler := NewHealthHandler([]HealthCheck{
+			{Name: "redis", Check: func(ctx context.Context) error { return errors.New("connection refused") }},
+		}, time.Second, discardLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rr := httptest.NewRecorder()
+
+		handler.Ready(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.JSONEq(t, `{"status":"unavailable","components":{"redis":{"status":"unavailable"},"shutdown":{"status":"ok"}}}`, rr.Body.String())
+		assert.NotContains(t, rr.Body.String(), "connection refused")
+	})
+
+	t.Run("Should not be ready while draining", func(t *testing.T) {
+		handler := NewHealthHandler([]HealthCheck{
+			{Name: "redis", Check: passingCheck},
+		}, time.Second, discardLogger())
+		handler.Drain()
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rr := httptest.NewRecorder()
+
+		handler.Ready(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.JSONEq(t, `{"status":"unavailable","components":{"redis":{"status":"ok"},"shutdown":{"status":"draining"}}}`, rr.Body.String())
+	})
+}
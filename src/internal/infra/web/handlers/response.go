@@ -0,0 +1,5 @@
+package handlers
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
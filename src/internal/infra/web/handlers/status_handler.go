@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+type StatusResponse struct {
+	Rule      string `json:"rule"`
+	KeyType   string `json:"key_type"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+	Reset     int64  `json:"reset"`
+}
+
+// StatusHandler reports the quota left for a key without consuming it.
+type StatusHandler struct {
+	Limiter ratelimiter.RateLimiterInterface
+	Logger  *slog.Logger
+}
+
+func NewStatusHandler(limiter ratelimiter.RateLimiterInterface, logger *slog.Logger) *StatusHandler {
+	return &StatusHandler{
+		Limiter: limiter,
+		Logger:  logger,
+	}
+}
+
+// Own returns the state of the caller's own key, identified like any other
+// request. The method and path query parameters pick the route, GET / by
+// default.
+func (h *StatusHandler) Own(w http.ResponseWriter, r *http.Request) {
+	descriptor := ratelimiter.RequestDescriptor(r)
+	routeFromQuery(r, &descriptor)
+
+	h.write(w, r, descriptor)
+}
+
+// Inspect returns the state of the key given by the ip or api_key query
+// parameter, for the route given by method and path. An api_key that is not
+// registered, given without an ip, is not found rather than reported as the
+// state of an empty IP.
+func (h *StatusHandler) Inspect(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	descriptor := ratelimiter.Descriptor{
+		ClientIP: params.Get("ip"),
+		APIKey:   params.Get("api_key"),
+	}
+	if descriptor.ClientIP == "" && descriptor.APIKey == "" {
+		writeBadRequest(w, "ip or api_key is required")
+		return
+	}
+	routeFromQuery(r, &descriptor)
+
+	result, ok := h.peek(w, r, descriptor)
+	if !ok {
+		return
+	}
+	if descriptor.ClientIP == "" && result.KeyType != ratelimiter.KeyTypeToken {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Token not found",
+		})
+		return
+	}
+
+	writeStatus(w, result)
+}
+
+func (h *StatusHandler) write(w http.ResponseWriter, r *http.Request, descriptor ratelimiter.Descriptor) {
+	if result, ok := h.peek(w, r, descriptor); ok {
+		writeStatus(w, result)
+	}
+}
+
+// peek reads the state of the descriptor, answering with the error response
+// when it cannot.
+func (h *StatusHandler) peek(w http.ResponseWriter, r *http.Request, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, bool) {
+	result, err := h.Limiter.Peek(r.Context(), descriptor)
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "unable to peek rate limit state", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Unable to read the rate limit state",
+		})
+		return nil, false
+	}
+	return result, true
+}
+
+func writeStatus(w http.ResponseWriter, result *strategies.LimitResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newStatusResponse(result))
+}
+
+func newStatusResponse(result *strategies.LimitResponse) StatusResponse {
+	return StatusResponse{
+		Rule:      result.Rule,
+		KeyType:   result.KeyType,
+		Limit:     result.Limit,
+		Used:      result.Total,
+		Remaining: result.Remaining,
+		Reset:     result.ExpiresAt.Unix(),
+	}
+}
+
+func routeFromQuery(r *http.Request, descriptor *ratelimiter.Descriptor) {
+	params := r.URL.Query()
+	descriptor.Method = http.MethodGet
+	if method := params.Get("method"); method != "" {
+		descriptor.Method = method
+	}
+	descriptor.Path = "/"
+	if path := params.Get("path"); path != "" {
+		descriptor.Path = path
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type RateLimiterMock struct {
+	mock.Mock
+}
+
+func (m *RateLimiterMock) Check(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *RateLimiterMock) Refund(ctx context.Context, result *strategies.LimitResponse) error {
+	args := m.Called(ctx, result)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) Peek(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *RateLimiterMock) Reset(ctx context.Context, descriptor ratelimiter.Descriptor) error {
+	args := m.Called(ctx, descriptor)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) SetUsage(ctx context.Context, descriptor ratelimiter.Descriptor, used int64) error {
+	args := m.Called(ctx, descriptor, used)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) Grant(ctx context.Context, descriptor ratelimiter.Descriptor, bonus int64, ttl time.Duration) error {
+	args := m.Called(ctx, descriptor, bonus, ttl)
+	return args.Error(0)
+}
+
+func TestStatusHandlerOwn(t *testing.T) {
+	t.Run("Should return the state of the caller key for the route", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		handler := NewStatusHandler(limiter, discardLogger())
+
+		limiter.On("Peek", mock.Anything, ratelimiter.Descriptor{
+			Method:   http.MethodPost,
+			Path:     "/export",
+			ClientIP: "192.0.2.1",
+			APIKey:   "abc",
+		}).Return(&strategies.LimitResponse{
+			Rule:      "export",
+			KeyType:   ratelimiter.KeyTypeToken,
+			Limit:     10,
+			Total:     4,
+			Remaining: 6,
+			ExpiresAt: time.Date(2024, 10, 24, 3, 1, 0, 0, time.UTC),
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/ratelimit/status?method=POST&path=/export", nil)
+		req.Header.Set("API_KEY", "abc")
+		rr := httptest.NewRecorder()
+
+		handler.Own(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"rule":"export","key_type":"token","limit":10,"used":4,"remaining":6,"reset":1729738860}`, rr.Body.String())
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should not leak store errors", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		handler := NewStatusHandler(limiter, discardLogger())
+
+		limiter.On("Peek", mock.Anything, mock.Anything).Return(nil, errors.New("redis down"))
+
+		rr := httptest.NewRecorder()
+
+		handler.Own(rr, httptest.NewRequest(http.MethodGet, "/ratelimit/status", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "redis")
+	})
+}
+
+func TestStatusHandlerInspect(t *testing.T) {
+	t.Run("Should return the state of the given key", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		handler := NewStatusHandler(limiter, discardLogger())
+
+		limiter.On("Peek", mock.Anything, ratelimiter.Descriptor{
+			Method:   http.MethodGet,
+			Path:     "/",
+			ClientIP: "203.0.113.7",
+		}).Return(&strategies.LimitResponse{Rule: "default", KeyType: ratelimiter.KeyTypeIP, Limit: 10, Remaining: 10}, nil)
+
+		rr := httptest.NewRecorder()
+
+		handler.Inspect(rr, httptest.NewRequest(http.MethodGet, "/admin/ratelimit/status?ip=203.0.113.7", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should not find tokens that are not registered", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		handler := NewStatusHandler(limiter, discardLogger())
+
+		limiter.On("Peek", mock.Anything, ratelimiter.Descriptor{
+			Method: http.MethodGet,
+			Path:   "/",
+			APIKey: "unknown",
+		}).Return(&strategies.LimitResponse{Rule: "default", KeyType: ratelimiter.KeyTypeIP, Limit: 10, Remaining: 10}, nil)
+
+		rr := httptest.NewRecorder()
+
+		handler.Inspect(rr, httptest.NewRequest(http.MethodGet, "/admin/ratelimit/status?api_key=unknown", nil))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "remaining")
+	})
+
+	t.Run("Should require a key", func(t *testing.T) {
+		handler := NewStatusHandler(new(RateLimiterMock), discardLogger())
+
+		rr := httptest.NewRecorder()
+
+		handler.Inspect(rr, httptest.NewRequest(http.MethodGet, "/admin/ratelimit/status", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
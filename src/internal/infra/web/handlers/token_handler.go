@@ -1,27 +1,51 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/go-chi/chi/v5"
 	"github.com/redis/go-redis/v9"
 )
 
+const ActorHeader = "X-Admin-Actor"
+
 type TokenHandler struct {
 	Client *redis.Client
+	Logger *slog.Logger
+	Events events.Publisher
+	Audit  audit.Recorder
 }
 
-func NewTokenHandler(client *redis.Client) *TokenHandler {
+func NewTokenHandler(
+	client *redis.Client,
+	logger *slog.Logger,
+	publisher events.Publisher,
+	auditRecorder audit.Recorder,
+) *TokenHandler {
 	return &TokenHandler{
 		Client: client,
+		Logger: logger,
+		Events: publisher,
+		Audit:  auditRecorder,
 	}
 }
 
 type TokenRequest struct {
 	Token       string `json:"token"`
 	MaxRequests int    `json:"max_requests"`
+	// BillingAnchor is the RFC 3339 start of the billing cycle, which the
+	// periods of the rules follow for the token.
+	BillingAnchor string `json:"billing_anchor"`
 }
 
 type TokenResponse struct {
@@ -40,7 +64,7 @@ func (h *TokenHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if dto.Token == "" || dto.MaxRequests <= 0 {
+	if dto.Token == "" || dto.MaxRequests <= 0 || !validAnchor(dto.BillingAnchor) {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(TokenResponse{
 			Message: "Invalid body",
@@ -49,10 +73,134 @@ func (h *TokenHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	key := fmt.Sprintf("token_max_req:%s", dto.Token)
-	h.Client.Set(context.Background(), key, dto.MaxRequests, 0)
+	previous, err := h.Client.SetArgs(r.Context(), key, dto.MaxRequests, redis.SetArgs{Get: true}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		h.Logger.ErrorContext(r.Context(), "unable to save token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TokenResponse{
+			Message: "Unable to save the token",
+		})
+		return
+	}
+
+	if dto.BillingAnchor != "" {
+		anchorKey := fmt.Sprintf("token_anchor:%s", dto.Token)
+		if err := h.Client.Set(r.Context(), anchorKey, dto.BillingAnchor, 0).Err(); err != nil {
+			h.Logger.ErrorContext(r.Context(), "unable to save token billing anchor", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(TokenResponse{
+				Message: "Unable to save the token",
+			})
+			return
+		}
+	}
+
+	h.Logger.InfoContext(r.Context(), "token registered", "token_hash", logging.HashKey(dto.Token), "max_requests", dto.MaxRequests)
+	h.Events.Publish(r.Context(), events.Event{
+		Type:    events.TypeTokenChange,
+		KeyType: "token",
+		KeyHash: logging.HashKey(dto.Token),
+		Limit:   int64(dto.MaxRequests),
+	})
+
+	action := audit.ActionTokenCreate
+	if previous != "" {
+		action = audit.ActionTokenUpdate
+	}
+	h.record(r, audit.Entry{
+		Action: action,
+		Target: logging.HashKey(dto.Token),
+		Before: previous,
+		After:  strconv.Itoa(dto.MaxRequests),
+	})
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(TokenResponse{
 		Message: "Token registered",
 	})
 }
+
+func (h *TokenHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	key := fmt.Sprintf("token_max_req:%s", token)
+	previous, err := h.Client.GetDel(r.Context(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(TokenResponse{
+			Message: "Token not found",
+		})
+		return
+	}
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "unable to delete token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TokenResponse{
+			Message: "Unable to delete the token",
+		})
+		return
+	}
+
+	if err := h.Client.Del(r.Context(), fmt.Sprintf("token_anchor:%s", token)).Err(); err != nil {
+		h.Logger.WarnContext(r.Context(), "unable to delete token billing anchor", "error", err)
+	}
+
+	h.Logger.InfoContext(r.Context(), "token deleted", "token_hash", logging.HashKey(token))
+	h.Events.Publish(r.Context(), events.Event{
+		Type:    events.TypeTokenChange,
+		KeyType: "token",
+		KeyHash: logging.HashKey(token),
+	})
+	h.record(r, audit.Entry{
+		Action: audit.ActionTokenDelete,
+		Target: logging.HashKey(token),
+		Before: previous,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TokenResponse{
+		Message: "Token deleted",
+	})
+}
+
+func validAnchor(anchor string) bool {
+	if anchor == "" {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, anchor)
+	return err == nil
+}
+
+func (h *TokenHandler) record(r *http.Request, entry audit.Entry) {
+	recordAudit(r, h.Audit, h.Logger, entry)
+}
+
+// recordAudit appends the change to the audit log. The change is already
+// applied, so a failure is only logged.
+func recordAudit(r *http.Request, recorder audit.Recorder, logger *slog.Logger, entry audit.Entry) {
+	entry.Actor = requestActor(r)
+	entry.Source = "ip:" + peerIP(r)
+	if err := recorder.Record(r.Context(), entry); err != nil {
+		logger.ErrorContext(r.Context(), "unable to record audit entry", "action", entry.Action, "error", err)
+	}
+}
+
+// requestActor identifies who made an admin change, falling back to the
+// client IP when the caller does not name itself. The name is declared by
+// the caller, so the entry also keeps the address in Source.
+func requestActor(r *http.Request) string {
+	if actor := r.Header.Get(ActorHeader); actor != "" {
+		return actor
+	}
+	return "ip:" + peerIP(r)
+}
+
+// peerIP is the address of the connection, which forwarding headers cannot
+// replace.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
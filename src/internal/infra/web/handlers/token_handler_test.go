@@ -2,21 +2,52 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/audit"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type recordingPublisher struct {
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event events.Event) {
+	p.events = append(p.events, event)
+}
+
+type recordingAuditor struct {
+	entries []audit.Entry
+}
+
+func (a *recordingAuditor) Record(ctx context.Context, entry audit.Entry) error {
+	a.entries = append(a.entries, entry)
+	return nil
+}
+
 func TestTokenHandler_Create_Success(t *testing.T) {
 	token := "dummy_token"
 	db, clientMock := redismock.NewClientMock()
-	handler := NewTokenHandler(db)
+	publisher := &recordingPublisher{}
+	auditor := &recordingAuditor{}
+	handler := NewTokenHandler(db, discardLogger(), publisher, auditor)
 
-	clientMock.ExpectSet("token_max_req:"+token, 10, time.Duration(0)).SetVal("OK")
+	clientMock.ExpectSetArgs("token_max_req:"+token, 10, redis.SetArgs{Get: true}).RedisNil()
 
 	body := `{"token":"dummy_token","max_requests":10}`
 	req := httptest.NewRequest(http.MethodPost, "/create-token", bytes.NewBufferString(body))
@@ -27,11 +58,76 @@ func TestTokenHandler_Create_Success(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, rr.Code)
 	assert.JSONEq(t, `{"message":"Token registered"}`, rr.Body.String())
 	assert.NoError(t, clientMock.ExpectationsWereMet())
+	assert.Len(t, publisher.events, 1)
+	assert.Equal(t, events.TypeTokenChange, publisher.events[0].Type)
+	assert.Equal(t, int64(10), publisher.events[0].Limit)
+	assert.Equal(t, []audit.Entry{
+		{
+			Actor:  "ip:192.0.2.1",
+			Source: "ip:192.0.2.1",
+			Action: audit.ActionTokenCreate,
+			Target: logging.HashKey(token),
+			After:  "10",
+		},
+	}, auditor.entries)
+}
+
+func TestTokenHandlerCreateWithBillingAnchor(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, &recordingAuditor{})
+
+	t.Run("Should save the billing anchor of the token", func(t *testing.T) {
+		clientMock.ExpectSetArgs("token_max_req:dummy_token", 10, redis.SetArgs{Get: true}).RedisNil()
+		clientMock.ExpectSet("token_anchor:dummy_token", "2024-10-15T00:00:00-03:00", 0).SetVal("OK")
+
+		body := `{"token":"dummy_token","max_requests":10,"billing_anchor":"2024-10-15T00:00:00-03:00"}`
+		rr := httptest.NewRecorder()
+		handler.Create(rr, httptest.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(body)))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should reject anchors that are not RFC 3339", func(t *testing.T) {
+		body := `{"token":"dummy_token","max_requests":10,"billing_anchor":"15/10/2024"}`
+		rr := httptest.NewRecorder()
+		handler.Create(rr, httptest.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(body)))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestTokenHandlerCreateUpdatesExistingToken(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	auditor := &recordingAuditor{}
+	handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, auditor)
+
+	clientMock.ExpectSetArgs("token_max_req:dummy_token", 20, redis.SetArgs{Get: true}).SetVal("10")
+
+	body := `{"token":"dummy_token","max_requests":20}`
+	req := httptest.NewRequest(http.MethodPost, "/create-token", bytes.NewBufferString(body))
+	req.Header.Set(ActorHeader, "alice")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rr := httptest.NewRecorder()
+
+	handler.Create(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, []audit.Entry{
+		{
+			Actor:  "alice",
+			Source: "ip:192.0.2.1",
+			Action: audit.ActionTokenUpdate,
+			Target: logging.HashKey("dummy_token"),
+			Before: "10",
+			After:  "20",
+		},
+	}, auditor.entries)
 }
 
 func TestTokenHandlerCreateBadRequestInvalidBody(t *testing.T) {
 	db, _ := redismock.NewClientMock()
-	handler := NewTokenHandler(db)
+	handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, &recordingAuditor{})
 
 	body := `{"token":"","max_requests":0}`
 	req := httptest.NewRequest(http.MethodPost, "/create-token", bytes.NewBufferString(body))
@@ -45,7 +141,7 @@ func TestTokenHandlerCreateBadRequestInvalidBody(t *testing.T) {
 
 func TestTokenHandlerCreateBadRequestBodyDecodeError(t *testing.T) {
 	db, _ := redismock.NewClientMock()
-	handler := NewTokenHandler(db)
+	handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, &recordingAuditor{})
 
 	body := `{"token":`
 	req := httptest.NewRequest(http.MethodPost, "/create-token", bytes.NewBufferString(body))
@@ -56,3 +152,68 @@ func TestTokenHandlerCreateBadRequestBodyDecodeError(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	assert.JSONEq(t, `{"message":"Unable to read the body"}`, rr.Body.String())
 }
+
+func TestTokenHandlerCreateInternalServerError(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, &recordingAuditor{})
+
+	clientMock.ExpectSetArgs("token_max_req:dummy_token", 10, redis.SetArgs{Get: true}).SetErr(errors.New("redis unavailable"))
+
+	body := `{"token":"dummy_token","max_requests":10}`
+	req := httptest.NewRequest(http.MethodPost, "/create-token", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	handler.Create(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"message":"Unable to save the token"}`, rr.Body.String())
+}
+
+func TestTokenHandlerDelete(t *testing.T) {
+	newRequest := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodDelete, "/token/"+token, nil)
+		req.Header.Set(ActorHeader, "alice")
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("token", token)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+	}
+
+	t.Run("Should delete the token and audit the change", func(t *testing.T) {
+		db, clientMock := redismock.NewClientMock()
+		auditor := &recordingAuditor{}
+		handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, auditor)
+
+		clientMock.ExpectGetDel("token_max_req:dummy_token").SetVal("10")
+		clientMock.ExpectDel("token_anchor:dummy_token").SetVal(0)
+
+		rr := httptest.NewRecorder()
+		handler.Delete(rr, newRequest("dummy_token"))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"message":"Token deleted"}`, rr.Body.String())
+		assert.Equal(t, []audit.Entry{
+			{
+				Actor:  "alice",
+				Source: "ip:192.0.2.1",
+				Action: audit.ActionTokenDelete,
+				Target: logging.HashKey("dummy_token"),
+				Before: "10",
+			},
+		}, auditor.entries)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should answer 404 for unknown tokens", func(t *testing.T) {
+		db, clientMock := redismock.NewClientMock()
+		auditor := &recordingAuditor{}
+		handler := NewTokenHandler(db, discardLogger(), events.NopPublisher{}, auditor)
+
+		clientMock.ExpectGetDel("token_max_req:unknown").RedisNil()
+
+		rr := httptest.NewRecorder()
+		handler.Delete(rr, newRequest("unknown"))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Empty(t, auditor.entries)
+	})
+}
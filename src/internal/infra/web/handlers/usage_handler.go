@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
+)
+
+const defaultUsageRange = 30 * 24 * time.Hour
+
+type UsageHandler struct {
+	Reader usage.Reader
+	Logger *slog.Logger
+	Now    func() time.Time
+}
+
+func NewUsageHandler(reader usage.Reader, logger *slog.Logger, now func() time.Time) *UsageHandler {
+	return &UsageHandler{
+		Reader: reader,
+		Logger: logger,
+		Now:    now,
+	}
+}
+
+type UsageResponse struct {
+	Granularity string         `json:"granularity"`
+	Buckets     []usage.Bucket `json:"buckets"`
+}
+
+// Report returns the usage buckets of the token query parameter. from and to
+// take RFC 3339 instants or dates, and default to the last 30 days;
+// granularity is hour or day, the default.
+func (h *UsageHandler) Report(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := usage.Query{
+		Token:       params.Get("token"),
+		To:          h.Now(),
+		Granularity: params.Get("granularity"),
+	}
+	if query.Token == "" {
+		writeBadRequest(w, "Missing token")
+		return
+	}
+	if query.Granularity == "" {
+		query.Granularity = usage.GranularityDay
+	}
+
+	var err error
+	if to := params.Get("to"); to != "" {
+		if query.To, err = parseInstant(to); err != nil {
+			writeBadRequest(w, "Invalid to")
+			return
+		}
+	}
+	query.From = query.To.Add(-defaultUsageRange)
+	if from := params.Get("from"); from != "" {
+		if query.From, err = parseInstant(from); err != nil {
+			writeBadRequest(w, "Invalid from")
+			return
+		}
+	}
+
+	buckets, err := h.Reader.Report(r.Context(), query)
+	if errors.Is(err, usage.ErrInvalidGranularity) {
+		writeBadRequest(w, "Invalid granularity")
+		return
+	}
+	if errors.Is(err, usage.ErrInvalidRange) || errors.Is(err, usage.ErrRangeTooLong) {
+		writeBadRequest(w, "Invalid range")
+		return
+	}
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "unable to read usage", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MessageResponse{
+			Message: "Unable to read the usage",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UsageResponse{
+		Granularity: query.Granularity,
+		Buckets:     buckets,
+	})
+}
+
+// parseInstant reads an RFC 3339 instant or a date, taken as UTC midnight.
+func parseInstant(value string) (time.Time, error) {
+	if instant, err := time.Parse(time.RFC3339, value); err == nil {
+		return instant, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
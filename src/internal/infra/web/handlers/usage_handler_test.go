@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUsageReader struct {
+	query   usage.Query
+	buckets []usage.Bucket
+	err     error
+}
+
+func (f *fakeUsageReader) Report(ctx context.Context, query usage.Query) ([]usage.Bucket, error) {
+	f.query = query
+	return f.buckets, f.err
+}
+
+func TestUsageHandlerReport(t *testing.T) {
+	now := func() time.Time { return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC) }
+
+	t.Run("Should pass the query and return the buckets", func(t *testing.T) {
+		reader := &fakeUsageReader{buckets: []usage.Bucket{
+			{Start: time.Date(2024, 10, 23, 0, 0, 0, 0, time.UTC), Allowed: 40, Denied: 2},
+		}}
+		handler := NewUsageHandler(reader, discardLogger(), now)
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/usage?token=dummy_token&from=2024-10-23&to=2024-10-24T00:00:00Z&granularity=day", nil)
+		rr := httptest.NewRecorder()
+
+		handler.Report(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, usage.Query{
+			Token:       "dummy_token",
+			From:        time.Date(2024, 10, 23, 0, 0, 0, 0, time.UTC),
+			To:          time.Date(2024, 10, 24, 0, 0, 0, 0, time.UTC),
+			Granularity: usage.GranularityDay,
+		}, reader.query)
+		assert.JSONEq(t, `{"granularity":"day","buckets":[{"start":"2024-10-23T00:00:00Z","allowed":40,"denied":2}]}`, rr.Body.String())
+	})
+
+	t.Run("Should default to the daily usage of the last 30 days", func(t *testing.T) {
+		reader := &fakeUsageReader{}
+		handler := NewUsageHandler(reader, discardLogger(), now)
+
+		handler.Report(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/usage?token=dummy_token", nil))
+
+		assert.Equal(t, now().AddDate(0, 0, -30), reader.query.From)
+		assert.Equal(t, now(), reader.query.To)
+		assert.Equal(t, usage.GranularityDay, reader.query.Granularity)
+	})
+
+	t.Run("Should reject invalid queries", func(t *testing.T) {
+		handler := NewUsageHandler(&fakeUsageReader{err: usage.ErrInvalidGranularity}, discardLogger(), now)
+
+		rr := httptest.NewRecorder()
+		handler.Report(rr, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"message":"Missing token"}`, rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		handler.Report(rr, httptest.NewRequest(http.MethodGet, "/admin/usage?token=dummy_token&granularity=week", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"message":"Invalid granularity"}`, rr.Body.String())
+	})
+}
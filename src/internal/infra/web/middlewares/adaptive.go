@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+)
+
+// AdaptiveMiddleware measures how long the backend takes to answer and with
+// which status, so adaptive rules can follow its health. It runs after the
+// limiters, so denied requests are not measured.
+type AdaptiveMiddleware struct {
+	Observer ratelimiter.HealthObserverInterface
+	Now      func() time.Time
+}
+
+func NewAdaptiveMiddleware(observer ratelimiter.HealthObserverInterface, now func() time.Time) *AdaptiveMiddleware {
+	return &AdaptiveMiddleware{
+		Observer: observer,
+		Now:      now,
+	}
+}
+
+func (am *AdaptiveMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := am.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		am.Observer.Observe(ratelimiter.RequestDescriptor(r), am.Now().Sub(start), sw.status)
+	})
+}
+
+// statusWriter records the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+func (sw *statusWriter) Flush() {
+	sw.wroteHeader = true
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+type observation struct {
+	path    string
+	latency time.Duration
+	status  int
+}
+
+type fakeObserver struct {
+	observations []observation
+}
+
+func (f *fakeObserver) Observe(descriptor ratelimiter.Descriptor, latency time.Duration, status int) {
+	f.observations = append(f.observations, observation{path: descriptor.Path, latency: latency, status: status})
+}
+
+func TestAdaptiveMiddlewareHandle(t *testing.T) {
+	t.Run("Should observe the latency and status of the response", func(t *testing.T) {
+		observer := &fakeObserver{}
+		now := time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+		middleware := NewAdaptiveMiddleware(observer, func() time.Time { return now })
+
+		rr := httptest.NewRecorder()
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now = now.Add(300 * time.Millisecond)
+			w.WriteHeader(http.StatusBadGateway)
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/1", nil))
+
+		assert.Equal(t, []observation{{path: "/reports/1", latency: 300 * time.Millisecond, status: http.StatusBadGateway}}, observer.observations)
+	})
+
+	t.Run("Should observe an OK status when the handler writes none", func(t *testing.T) {
+		observer := &fakeObserver{}
+		middleware := NewAdaptiveMiddleware(observer, time.Now)
+
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, observer.observations[0].status)
+	})
+}
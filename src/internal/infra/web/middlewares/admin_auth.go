@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+const AdminKeyHeader = "X-Admin-Key"
+
+type AdminAuthMiddleware struct {
+	Key string
+}
+
+func NewAdminAuthMiddleware(key string) *AdminAuthMiddleware {
+	return &AdminAuthMiddleware{
+		Key: key,
+	}
+}
+
+// Handle only lets through requests carrying the admin key. Admin endpoints
+// stay closed while no key is configured.
+func (am *AdminAuthMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(AdminKeyHeader)
+		if am.Key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(am.Key)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "invalid admin key",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
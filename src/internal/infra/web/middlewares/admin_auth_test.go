@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuthMiddlewareHandle(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		configured string
+		informed   string
+		expected   int
+	}{
+		{"Should allow the configured key", "secret", "secret", http.StatusNoContent},
+		{"Should reject a wrong key", "secret", "guess", http.StatusUnauthorized},
+		{"Should reject a missing key", "secret", "", http.StatusUnauthorized},
+		{"Should reject everything when no key is configured", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/events", nil)
+			if tt.informed != "" {
+				req.Header.Set(AdminKeyHeader, tt.informed)
+			}
+			rr := httptest.NewRecorder()
+
+			NewAdminAuthMiddleware(tt.configured).Handle(nextHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
+	}
+}
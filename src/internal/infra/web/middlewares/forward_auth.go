@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Headers sent by ingresses (nginx auth_request, Traefik ForwardAuth) to
+// describe the original request.
+const (
+	OriginalURIHeader     = "X-Original-URI"
+	OriginalMethodHeader  = "X-Original-Method"
+	ForwardedURIHeader    = "X-Forwarded-Uri"
+	ForwardedMethodHeader = "X-Forwarded-Method"
+	ForwardedHostHeader   = "X-Forwarded-Host"
+)
+
+// ForwardAuth answers an ingress sub-request with the limiter decision for the
+// original request: 200 when allowed, the deny response otherwise, both with
+// the limit headers so the ingress can copy them to the client. The client IP
+// and API key are read from the forwarded headers.
+func (rlm *RateLimiterMiddleware) ForwardAuth(w http.ResponseWriter, r *http.Request) {
+	original, ok := originalRequest(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rlm.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, original)
+}
+
+func originalRequest(r *http.Request) (*http.Request, bool) {
+	uri := firstHeader(r, OriginalURIHeader, ForwardedURIHeader)
+	if uri == "" {
+		return nil, false
+	}
+	target, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, false
+	}
+
+	original := r.Clone(r.Context())
+	original.URL = target
+	original.RequestURI = uri
+	if method := firstHeader(r, OriginalMethodHeader, ForwardedMethodHeader); method != "" {
+		original.Method = method
+	}
+	if host := r.Header.Get(ForwardedHostHeader); host != "" {
+		original.Host = host
+	}
+
+	return original, true
+}
+
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
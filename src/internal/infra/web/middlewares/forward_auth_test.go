@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/httpmw"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRateLimiterMiddlewareForwardAuth(t *testing.T) {
+	t.Run("Should check the original request and allow it", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+
+		mockLimiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Method:   http.MethodPost,
+			Path:     "/export",
+			ClientIP: "203.0.113.7",
+			APIKey:   "abc",
+		}).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     10,
+			Remaining: 9,
+			ExpiresAt: time.Now().Add(time.Minute),
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+		req.Header.Set(ForwardedURIHeader, "/export?format=csv")
+		req.Header.Set(ForwardedMethodHeader, http.MethodPost)
+		req.Header.Set(ForwardedHostHeader, "app.example.com")
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.Header.Set("API_KEY", "abc")
+		rr := httptest.NewRecorder()
+
+		middleware.ForwardAuth(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "9", rr.Header().Get("X-RateLimit-Remaining"))
+		mockLimiter.AssertExpectations(t)
+	})
+
+	t.Run("Should deny with the limit headers", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+
+		mockLimiter.On("Check", mock.Anything, mock.MatchedBy(func(descriptor ratelimiter.Descriptor) bool {
+			return descriptor.Method == http.MethodGet && descriptor.Path == "/items"
+		})).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Rule:      "default",
+			Limit:     10,
+			Remaining: 0,
+			ExpiresAt: time.Now().Add(time.Minute),
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+		req.Header.Set(OriginalURIHeader, "/items")
+		rr := httptest.NewRecorder()
+
+		middleware.ForwardAuth(rr, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	})
+
+	t.Run("Should reject sub-requests without the original URI", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+
+		req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+		rr := httptest.NewRecorder()
+
+		middleware.ForwardAuth(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockLimiter.AssertNotCalled(t, "Check", mock.Anything, mock.Anything)
+	})
+}
@@ -1,53 +1,139 @@
 package middlewares
 
 import (
-	"encoding/json"
+	"context"
+	"log/slog"
 	"net/http"
-	"strconv"
 
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/httpmw"
 	limiter "github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type RateLimiterMiddlewareInterface interface {
 	Handle(next http.Handler) http.Handler
 }
 
+// RateLimiterMiddleware is the httpmw middleware of the server, observed to
+// count, log and publish its decisions and to record the usage of tokens.
 type RateLimiterMiddleware struct {
-	Limiter ratelimiter.RateLimiterInterface
+	HTTP        *httpmw.Middleware
+	Metrics     *metrics.Metrics
+	Logger      *slog.Logger
+	DenySampler *logging.Sampler
+	Events      events.Publisher
+	Usage       usage.Recorder
 }
 
 func NewRateLimiterMiddleware(
 	limiter ratelimiter.RateLimiterInterface,
+	responder *httpmw.Responder,
+	wouldDenyHeader bool,
+	metrics *metrics.Metrics,
+	logger *slog.Logger,
+	denySampler *logging.Sampler,
+	publisher events.Publisher,
+	refundHeader bool,
+	usageRecorder usage.Recorder,
 ) *RateLimiterMiddleware {
-	return &RateLimiterMiddleware{
-		Limiter: limiter,
+	rlm := &RateLimiterMiddleware{
+		Metrics:     metrics,
+		Logger:      logger,
+		DenySampler: denySampler,
+		Events:      publisher,
+		Usage:       usageRecorder,
 	}
+
+	rlm.HTTP = httpmw.NewMiddleware(limiter)
+	rlm.HTTP.Responder = responder
+	rlm.HTTP.WouldDenyHeader = wouldDenyHeader
+	rlm.HTTP.RefundHeader = refundHeader
+	rlm.HTTP.Observer = rlm
+	rlm.HTTP.Logger = logger
+
+	return rlm
 }
 
 func (rlm *RateLimiterMiddleware) Handle(next http.Handler) http.Handler {
+	handler := rlm.HTTP.Handler(next)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		result, err := rlm.Limiter.Check(r.Context(), r)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{
-				"message": err.Error(),
-			})
-			return
-		}
+		// keep the caller trace so limiter spans join it
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
-		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
-		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ExpiresAt.Unix(), 10))
+// Observe counts, logs and publishes the decisions of the rate limiter and of
+// the concurrency limiter.
+func (rlm *RateLimiterMiddleware) Observe(ctx context.Context, descriptor ratelimiter.Descriptor, result *limiter.LimitResponse, err error) {
+	if err != nil {
+		rlm.Logger.ErrorContext(ctx, "rate limiter check failed", "method", descriptor.Method, "path", descriptor.Path, "error", err)
+		rlm.Metrics.RecordDecision(metrics.UnknownLabel, metrics.UnknownLabel, metrics.DecisionErrored)
+		return
+	}
+
+	rlm.reportShadows(ctx, descriptor, result)
 
-		if result.Result == limiter.Deny {
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(map[string]string{
-				"message": "you have reached the maximum number of requests or actions allowed within a certain time frame",
-			})
-			return
+	// tokens are billed for their allowed and denied requests
+	if result.KeyType == ratelimiter.KeyTypeToken {
+		rlm.Usage.Record(result.Key, result.Result == limiter.Allow)
+	}
+
+	if result.Result == limiter.Deny {
+		rlm.Metrics.RecordDecision(result.Rule, result.KeyType, metrics.DecisionDenied)
+		rlm.logDeny(ctx, descriptor, "request denied", result)
+		rlm.publishDeny(ctx, descriptor, events.DecisionDenied, result)
+		return
+	}
+
+	rlm.Metrics.RecordDecision(result.Rule, result.KeyType, metrics.DecisionAllowed)
+}
+
+// reportShadows logs and counts the shadow rules that would have denied the
+// request. They never block it.
+func (rlm *RateLimiterMiddleware) reportShadows(ctx context.Context, descriptor ratelimiter.Descriptor, result *limiter.LimitResponse) {
+	for _, shadow := range result.Shadows {
+		if shadow.Result == limiter.Deny {
+			rlm.Metrics.RecordDecision(shadow.Rule, shadow.KeyType, metrics.DecisionShadowDenied)
+			rlm.logDeny(ctx, descriptor, "shadow rule would deny", shadow)
+			rlm.publishDeny(ctx, descriptor, events.DecisionShadowDenied, shadow)
 		}
+	}
+}
+
+// logDeny logs a sampled share of the denials. Keys are hashed so IPs and
+// tokens are never written to the logs.
+func (rlm *RateLimiterMiddleware) logDeny(ctx context.Context, descriptor ratelimiter.Descriptor, msg string, result *limiter.LimitResponse) {
+	if !rlm.DenySampler.Sample() {
+		return
+	}
+
+	rlm.Logger.InfoContext(ctx, msg,
+		"method", descriptor.Method,
+		"path", descriptor.Path,
+		"rule", result.Rule,
+		"key_type", result.KeyType,
+		"key_hash", logging.HashKey(result.Key),
+		"limit", result.Limit,
+		"total", result.Total,
+	)
+}
 
-		next.ServeHTTP(w, r)
+func (rlm *RateLimiterMiddleware) publishDeny(ctx context.Context, descriptor ratelimiter.Descriptor, decision string, result *limiter.LimitResponse) {
+	rlm.Events.Publish(ctx, events.Event{
+		Type:     events.TypeDecision,
+		Decision: decision,
+		Rule:     result.Rule,
+		KeyType:  result.KeyType,
+		KeyHash:  logging.HashKey(result.Key),
+		Method:   descriptor.Method,
+		Path:     descriptor.Path,
+		Limit:    result.Limit,
 	})
 }
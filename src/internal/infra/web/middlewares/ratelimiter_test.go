@@ -1,29 +1,68 @@
 package middlewares
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/httpmw"
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type PublisherMock struct {
+	Events []events.Event
+}
+
+func (m *PublisherMock) Publish(ctx context.Context, event events.Event) {
+	m.Events = append(m.Events, event)
+}
+
 type RateLimiterMock struct {
 	mock.Mock
 }
 
-func (m *RateLimiterMock) Check(ctx context.Context, r *http.Request) (*strategies.LimitResponse, error) {
-	args := m.Called(ctx, r)
+func (m *RateLimiterMock) Check(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *RateLimiterMock) Refund(ctx context.Context, result *strategies.LimitResponse) error {
+	args := m.Called(ctx, result)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) Peek(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
 	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
 }
 
 func TestRateLimiterMiddlewareHandleAllow(t *testing.T) {
 	mockLimiter := new(RateLimiterMock)
-	middleware := NewRateLimiterMiddleware(mockLimiter)
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
 
 	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
 		Result:    strategies.Allow,
@@ -53,13 +92,18 @@ func TestRateLimiterMiddlewareHandleAllow(t *testing.T) {
 
 func TestRateLimiterMiddlewareHandleDeny(t *testing.T) {
 	mockLimiter := new(RateLimiterMock)
-	middleware := NewRateLimiterMiddleware(mockLimiter)
+	m := metrics.NewMetrics()
+	publisher := &PublisherMock{}
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, m, discardLogger(), logging.NewSampler(1), publisher, false, usage.NopRecorder{})
 
 	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
 		Result:    strategies.Deny,
 		Limit:     int64(10),
 		Remaining: int64(0),
 		ExpiresAt: time.Now().Add(1 * time.Hour),
+		Rule:      "default",
+		Key:       "192.0.2.1",
+		KeyType:   "ip",
 	}, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -68,13 +112,27 @@ func TestRateLimiterMiddlewareHandleDeny(t *testing.T) {
 	middleware.Handle(http.NotFoundHandler()).ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "application/problem+json; charset=utf-8", rr.Header().Get("Content-Type"))
 	assert.Contains(t, rr.Body.String(), "maximum number of requests")
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Decisions.WithLabelValues("default", "ip", metrics.DecisionDenied)))
+	assert.Equal(t, []events.Event{
+		{
+			Type:     events.TypeDecision,
+			Decision: events.DecisionDenied,
+			Rule:     "default",
+			KeyType:  "ip",
+			KeyHash:  logging.HashKey("192.0.2.1"),
+			Method:   http.MethodGet,
+			Path:     "/",
+			Limit:    10,
+		},
+	}, publisher.Events)
 	mockLimiter.AssertExpectations(t)
 }
 
 func TestRateLimiterMiddlewareHandleInternalServerError(t *testing.T) {
 	mockLimiter := new(RateLimiterMock)
-	middleware := NewRateLimiterMiddleware(mockLimiter)
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
 
 	mockLimiter.On("Check", mock.Anything, mock.Anything).Return((*strategies.LimitResponse)(nil), http.ErrHandlerTimeout)
 
@@ -84,6 +142,128 @@ func TestRateLimiterMiddlewareHandleInternalServerError(t *testing.T) {
 	middleware.Handle(http.NotFoundHandler()).ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	assert.Contains(t, rr.Body.String(), http.ErrHandlerTimeout.Error())
+	assert.NotContains(t, rr.Body.String(), http.ErrHandlerTimeout.Error())
+	assert.Contains(t, rr.Body.String(), httpmw.DefaultErrorMessage)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimiterMiddlewareHandleShadowDeny(t *testing.T) {
+	mockLimiter := new(RateLimiterMock)
+	m := metrics.NewMetrics()
+	publisher := &PublisherMock{}
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), true, m, discardLogger(), logging.NewSampler(1), publisher, false, usage.NopRecorder{})
+
+	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+		Result:    strategies.Allow,
+		Limit:     10,
+		Remaining: 5,
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+		Shadows: []*strategies.LimitResponse{
+			{Result: strategies.Deny, Rule: "strict", KeyType: "ip", Shadow: true},
+			{Result: strategies.Allow, Rule: "lenient", KeyType: "ip", Shadow: true},
+			{Result: strategies.Deny, Rule: "burst", KeyType: "ip", Shadow: true},
+		},
+	}, nil)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+
+	middleware.Handle(nextHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "strict, burst", rr.Header().Get("X-RateLimit-Would-Deny"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Decisions.WithLabelValues("strict", "ip", metrics.DecisionShadowDenied)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.Decisions.WithLabelValues("lenient", "ip", metrics.DecisionShadowDenied)))
+	assert.Len(t, publisher.Events, 2)
+	assert.Equal(t, events.DecisionShadowDenied, publisher.Events[0].Decision)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimiterMiddlewareHandlePropagatesTraceContext(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(previous)
+
+	mockLimiter := new(RateLimiterMock)
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	withIncomingTrace := mock.MatchedBy(func(ctx context.Context) bool {
+		return trace.SpanContextFromContext(ctx).TraceID().String() == traceID
+	})
+
+	mockLimiter.On("Check", withIncomingTrace, mock.Anything).Return(&strategies.LimitResponse{
+		Result:    strategies.Allow,
+		Limit:     10,
+		Remaining: 5,
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+	}, nil)
+
+	var nextTraceID string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextTraceID = trace.SpanContextFromContext(r.Context()).TraceID().String()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+
+	middleware.Handle(nextHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, traceID, nextTraceID)
 	mockLimiter.AssertExpectations(t)
 }
+
+func TestRateLimiterMiddlewareHandleLogsSampledDenials(t *testing.T) {
+	mockLimiter := new(RateLimiterMock)
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), logger, logging.NewSampler(2), events.NopPublisher{}, false, usage.NopRecorder{})
+
+	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+		Result:    strategies.Deny,
+		Limit:     10,
+		Total:     10,
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+		Rule:      "default",
+		Key:       "dummy_token",
+		KeyType:   "token",
+	}, nil)
+
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		middleware.Handle(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2, strings.Count(logs.String(), `msg="request denied"`))
+	assert.Contains(t, logs.String(), "key_hash="+logging.HashKey("dummy_token"))
+	assert.NotContains(t, logs.String(), "dummy_token")
+}
+
+type recordingUsage struct {
+	decisions map[string][]bool
+}
+
+func (u *recordingUsage) Record(token string, allowed bool) {
+	u.decisions[token] = append(u.decisions[token], allowed)
+}
+
+func TestRateLimiterMiddlewareHandleRecordsTokenUsage(t *testing.T) {
+	mockLimiter := new(RateLimiterMock)
+	recorder := &recordingUsage{decisions: map[string][]bool{}}
+	middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, recorder)
+
+	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{Result: strategies.Allow, Key: "dummy_token", KeyType: "token"}, nil).Once()
+	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{Result: strategies.Deny, Key: "dummy_token", KeyType: "token"}, nil).Once()
+	mockLimiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{Result: strategies.Allow, Key: "192.0.2.1", KeyType: "ip"}, nil).Once()
+
+	for range 3 {
+		middleware.Handle(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	assert.Equal(t, map[string][]bool{"dummy_token": {true, false}}, recorder.decisions)
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/events"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/metrics"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/usage"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/httpmw"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRateLimiterMiddlewareHandleRefund(t *testing.T) {
+	allowed := func(refundStatuses ...string) *strategies.LimitResponse {
+		return &strategies.LimitResponse{
+			Result:         strategies.Allow,
+			Limit:          10,
+			Remaining:      5,
+			ExpiresAt:      time.Now().Add(time.Minute),
+			RefundStatuses: refundStatuses,
+		}
+	}
+
+	t.Run("Should refund responses with a refunded status", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+		result := allowed("5xx")
+
+		mockLimiter.On("Check", mock.Anything, mock.Anything).Return(result, nil)
+		mockLimiter.On("Refund", mock.Anything, result).Return(nil)
+
+		rr := httptest.NewRecorder()
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		mockLimiter.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the quota of other statuses", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+
+		mockLimiter.On("Check", mock.Anything, mock.Anything).Return(allowed("5xx"), nil)
+
+		rr := httptest.NewRecorder()
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockLimiter.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should refund when the handler asks for it and remove the header", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, true, usage.NopRecorder{})
+		result := allowed()
+
+		mockLimiter.On("Check", mock.Anything, mock.Anything).Return(result, nil)
+		mockLimiter.On("Refund", mock.Anything, result).Return(nil)
+
+		rr := httptest.NewRecorder()
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(httpmw.RefundHeaderName, "true")
+			w.Write([]byte("cached"))
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Empty(t, rr.Header().Get(httpmw.RefundHeaderName))
+		mockLimiter.AssertExpectations(t)
+	})
+
+	t.Run("Should ignore the header when it is not enabled", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, false, usage.NopRecorder{})
+
+		mockLimiter.On("Check", mock.Anything, mock.Anything).Return(allowed("503"), nil)
+
+		rr := httptest.NewRecorder()
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(httpmw.RefundHeaderName, "true")
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		mockLimiter.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should keep the writer flushable", func(t *testing.T) {
+		mockLimiter := new(RateLimiterMock)
+		middleware := NewRateLimiterMiddleware(mockLimiter, httpmw.NewResponder(nil, nil, nil), false, metrics.NewMetrics(), discardLogger(), logging.NewSampler(1), events.NopPublisher{}, true, usage.NopRecorder{})
+
+		mockLimiter.On("Check", mock.Anything, mock.Anything).Return(allowed(), nil)
+
+		rr := httptest.NewRecorder()
+		middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, http.NewResponseController(w).Flush())
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.True(t, rr.Flushed)
+	})
+}
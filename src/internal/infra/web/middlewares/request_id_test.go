@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	var contextID string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextID = logging.RequestID(r.Context())
+	})
+
+	t.Run("Should keep the incoming request ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		rr := httptest.NewRecorder()
+
+		RequestID(nextHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, "abc-123", contextID)
+		assert.Equal(t, "abc-123", rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Should create a request ID when missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+
+		RequestID(nextHandler).ServeHTTP(rr, req)
+
+		assert.Len(t, contextID, 32)
+		assert.Equal(t, contextID, rr.Header().Get(RequestIDHeader))
+	})
+}
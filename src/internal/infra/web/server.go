@@ -1,16 +1,26 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Handler struct {
-	Path        string
+	Path string
+	// Method restricts the route to one method; empty matches any.
 	Method      string
 	HandlerFunc http.HandlerFunc
+	// SkipMiddlewares serves the route without the server middlewares, e.g.
+	// probes that must never be rate limited.
+	SkipMiddlewares bool
 }
 
 type Middleware struct {
@@ -18,29 +28,138 @@ type Middleware struct {
 	Handler func(next http.Handler) http.Handler
 }
 
+type ServerOptions struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	DrainTimeout      time.Duration
+	// ShutdownDelay keeps serving after the drain starts, so load balancers
+	// see the failing readiness before the listener closes.
+	ShutdownDelay time.Duration
+	// TLSConfig serves HTTPS (with HTTP/2) when set.
+	TLSConfig *tls.Config
+}
+
 type Server struct {
 	Router      chi.Router
 	Port        int
 	Handlers    []Handler
 	Middlewares []Middleware
+	Options     ServerOptions
+	Logger      *slog.Logger
+	onShutdown  []func()
 }
 
-func NewServer(serverPort int, handlers []Handler, middlewares []Middleware) *Server {
+func NewServer(
+	serverPort int,
+	handlers []Handler,
+	middlewares []Middleware,
+	options ServerOptions,
+	logger *slog.Logger,
+) *Server {
 	return &Server{
 		Router:      chi.NewRouter(),
 		Port:        serverPort,
 		Handlers:    handlers,
 		Middlewares: middlewares,
+		Options:     options,
+		Logger:      logger,
 	}
 }
 
-func (s *Server) Run() {
-	for _, m := range s.Middlewares {
-		s.Router.Use(m.Handler)
+// OnShutdown registers a function called when the drain starts, so readiness
+// can fail and long-lived handlers (e.g. streams) can end their responses.
+func (s *Server) OnShutdown(f func()) {
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// Run serves until the context is done, then stops accepting connections and
+// waits up to the drain timeout for in-flight requests.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
+	if err != nil {
+		return err
 	}
+
+	return s.Serve(ctx, listener)
+}
+
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	s.Router.Group(func(r chi.Router) {
+		for _, m := range s.Middlewares {
+			r.Use(m.Handler)
+		}
+		for _, h := range s.Handlers {
+			if !h.SkipMiddlewares {
+				route(r, h)
+			}
+		}
+	})
 	for _, h := range s.Handlers {
-		s.Router.MethodFunc(h.Method, h.Path, h.HandlerFunc)
+		if h.SkipMiddlewares {
+			route(s.Router, h)
+		}
+	}
+
+	httpServer := &http.Server{
+		Handler:           s.Router,
+		ReadTimeout:       s.Options.ReadTimeout,
+		ReadHeaderTimeout: s.Options.ReadHeaderTimeout,
+		WriteTimeout:      s.Options.WriteTimeout,
+		IdleTimeout:       s.Options.IdleTimeout,
+		MaxHeaderBytes:    s.Options.MaxHeaderBytes,
+		TLSConfig:         s.Options.TLSConfig,
+		ErrorLog:          slog.NewLogLogger(s.Logger.Handler(), slog.LevelWarn),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			s.Logger.Info("starting server", "addr", listener.Addr().String(), "tls", true)
+			// the certificate comes from the TLS config
+			serveErr <- httpServer.ServeTLS(listener, "", "")
+			return
+		}
+		s.Logger.Info("starting server", "addr", listener.Addr().String(), "tls", false)
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.Logger.Info("shutting down server", "shutdown_delay", s.Options.ShutdownDelay, "drain_timeout", s.Options.DrainTimeout)
+
+	for _, f := range s.onShutdown {
+		f()
+	}
+	time.Sleep(s.Options.ShutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.Options.DrainTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		httpServer.Close()
+		return fmt.Errorf("drain interrupted: %w", err)
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	s.Logger.Info("server stopped")
+
+	return nil
+}
+
+func route(r chi.Router, h Handler) {
+	if h.Method == "" {
+		r.HandleFunc(h.Path, h.HandlerFunc)
+		return
 	}
-	fmt.Printf("Starting server on port [%d]\n", s.Port)
-	http.ListenAndServe(fmt.Sprintf(":%d", s.Port), s.Router)
+	r.MethodFunc(h.Method, h.Path, h.HandlerFunc)
 }
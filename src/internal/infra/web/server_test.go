@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func newSlowServer(delay time.Duration, drain time.Duration, started chan struct{}) *Server {
+	handlers := []Handler{
+		{
+			Path:   "/slow",
+			Method: "GET",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(delay)
+				w.Write([]byte("done"))
+			},
+		},
+	}
+	return NewServer(0, handlers, nil, ServerOptions{DrainTimeout: drain}, discardLogger())
+}
+
+func TestServerServe(t *testing.T) {
+	t.Run("Should drain in-flight requests on shutdown", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+
+		started := make(chan struct{})
+		shutdownCalled := make(chan struct{})
+		server := newSlowServer(100*time.Millisecond, time.Second, started)
+		server.OnShutdown(func() { close(shutdownCalled) })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() { result <- server.Serve(ctx, listener) }()
+
+		response := make(chan string, 1)
+		go func() {
+			resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+			if err != nil {
+				response <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			response <- string(body)
+		}()
+
+		<-started
+		cancel()
+
+		assert.Equal(t, "done", <-response)
+		assert.NoError(t, <-result)
+		<-shutdownCalled
+	})
+
+	t.Run("Should fail when the drain times out", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+
+		started := make(chan struct{})
+		server := newSlowServer(time.Second, 10*time.Millisecond, started)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() { result <- server.Serve(ctx, listener) }()
+		go http.Get("http://" + listener.Addr().String() + "/slow")
+
+		<-started
+		cancel()
+
+		assert.ErrorContains(t, <-result, "drain interrupted")
+	})
+}
+
+func TestServerSkipMiddlewares(t *testing.T) {
+	t.Run("Should serve routes that skip middlewares without them", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		handlers := []Handler{
+			{Path: "/limited", Method: "GET", HandlerFunc: ok},
+			{Path: "/healthz", Method: "GET", HandlerFunc: ok, SkipMiddlewares: true},
+		}
+		middlewares := []Middleware{
+			{
+				Name: "Block",
+				Handler: func(next http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusTooManyRequests)
+					})
+				},
+			},
+		}
+		server := NewServer(0, handlers, middlewares, ServerOptions{DrainTimeout: time.Second}, discardLogger())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go server.Serve(ctx, listener)
+
+		resp, err := http.Get("http://" + listener.Addr().String() + "/limited")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+		resp, err = http.Get("http://" + listener.Addr().String() + "/healthz")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
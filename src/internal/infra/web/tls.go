@@ -0,0 +1,140 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ClientAuthNone          = "none"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+	ClientAuthRequire       = "require"
+)
+
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   string
+}
+
+// NewTLSConfig builds the server TLS config. The certificate is reloaded when
+// its files change, so rotations need no restart.
+func NewTLSConfig(options TLSOptions, logger *slog.Logger) (*tls.Config, error) {
+	reloader, err := NewCertReloader(options.CertFile, options.KeyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch options.ClientAuth {
+	case "", ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthVerifyIfGiven:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth %q", options.ClientAuth)
+	}
+
+	if options.ClientCAFile == "" {
+		return nil, errors.New("client auth requires a client CA file")
+	}
+	caPEM, err := os.ReadFile(options.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no certificate found in the client CA file")
+	}
+	tlsConfig.ClientCAs = pool
+
+	return tlsConfig, nil
+}
+
+// CertReloader serves a certificate pair, loading it again whenever one of the
+// files is modified. A failed reload keeps the previous certificate.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	Logger   *slog.Logger
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+func NewCertReloader(certFile string, keyFile string, logger *slog.Logger) (*CertReloader, error) {
+	reloader := &CertReloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Logger:   logger,
+	}
+
+	certTime, keyTime, err := reloader.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	reloader.certTime, reloader.keyTime = certTime, keyTime
+
+	return reloader, nil
+}
+
+func (cr *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	certTime, keyTime, err := cr.modTimes()
+	if err != nil || (certTime.Equal(cr.certTime) && keyTime.Equal(cr.keyTime)) {
+		return cr.cert, nil
+	}
+
+	// retried only after the next change, e.g. once both files are written
+	cr.certTime, cr.keyTime = certTime, keyTime
+	if err := cr.reload(); err != nil {
+		cr.Logger.Error("unable to reload certificate, keeping the previous one", "error", err)
+	} else {
+		cr.Logger.Info("certificate reloaded", "cert_file", cr.CertFile)
+	}
+
+	return cr.cert, nil
+}
+
+func (cr *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cr.CertFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("cannot read certificate file: %w", err)
+	}
+	keyInfo, err := os.Stat(cr.KeyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("cannot read key file: %w", err)
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (cr *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.CertFile, cr.KeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load certificate: %w", err)
+	}
+	cr.cert = &cert
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and returns its
+// certificate and key paths.
+func writeCert(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, commonName+".crt")
+	keyFile := filepath.Join(dir, commonName+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func copyFile(t *testing.T, from string, to string, modTime time.Time) {
+	data, err := os.ReadFile(from)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(to, data, 0o600))
+	require.NoError(t, os.Chtimes(to, modTime, modTime))
+}
+
+func TestCertReloader(t *testing.T) {
+	t.Run("Should reload the certificate when the files change", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "first")
+
+		reloader, err := NewCertReloader(certFile, keyFile, discardLogger())
+		require.NoError(t, err)
+
+		cert, err := reloader.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		assert.Equal(t, "first", leaf.Subject.CommonName)
+
+		newCert, newKey := writeCert(t, dir, "second")
+		later := time.Now().Add(time.Minute)
+		copyFile(t, newCert, certFile, later)
+		copyFile(t, newKey, keyFile, later)
+
+		cert, err = reloader.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+		assert.Equal(t, "second", leaf.Subject.CommonName)
+	})
+
+	t.Run("Should keep the previous certificate when the reload fails", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "first")
+
+		reloader, err := NewCertReloader(certFile, keyFile, discardLogger())
+		require.NoError(t, err)
+
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+		require.NoError(t, os.Chtimes(certFile, later, later))
+
+		cert, err := reloader.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		assert.Equal(t, "first", leaf.Subject.CommonName)
+	})
+
+	t.Run("Should fail when the certificate cannot be loaded", func(t *testing.T) {
+		_, err := NewCertReloader("missing.crt", "missing.key", discardLogger())
+		assert.Error(t, err)
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+
+	t.Run("Should require a client CA when verifying clients", func(t *testing.T) {
+		_, err := NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}, discardLogger())
+		assert.ErrorContains(t, err, "client CA")
+	})
+
+	t.Run("Should reject an unknown client auth", func(t *testing.T) {
+		_, err := NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: "maybe"}, discardLogger())
+		assert.ErrorContains(t, err, "unknown client auth")
+	})
+}
+
+func TestServerServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+
+	caPEM, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+
+	tlsConfig, err := NewTLSConfig(TLSOptions{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCert,
+		ClientAuth:   ClientAuthRequire,
+	}, discardLogger())
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	handlers := []Handler{
+		{
+			Path:   "/",
+			Method: "GET",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			},
+		},
+	}
+	server := NewServer(0, handlers, nil, ServerOptions{DrainTimeout: time.Second, TLSConfig: tlsConfig}, discardLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Serve(ctx, listener)
+
+	url := "https://" + listener.Addr().String() + "/"
+
+	t.Run("Should serve HTTP/2 to verified clients", func(t *testing.T) {
+		pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{pair}},
+			ForceAttemptHTTP2: true,
+		}}
+
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, resp.ProtoMajor)
+	})
+
+	t.Run("Should reject clients without a certificate", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		}}
+
+		_, err := client.Get(url)
+		assert.Error(t, err)
+	})
+}
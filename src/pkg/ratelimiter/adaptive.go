@@ -0,0 +1,181 @@
+package ratelimiter
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+const (
+	DefaultAdaptiveDecrease   = 0.5
+	DefaultAdaptiveInterval   = 10 * time.Second
+	DefaultAdaptiveMinSamples = 20
+)
+
+type HealthObserverInterface interface {
+	// Observe records how the backend answered an allowed request.
+	Observe(descriptor Descriptor, latency time.Duration, status int)
+}
+
+// AdaptiveLimiter adjusts the limits of the adaptive rules of the RateLimiter
+// with the health of the backend. Instances sample the allowed requests
+// locally and report them at every sync, so the limit is shared across
+// instances and the requests themselves wait on no round trip.
+type AdaptiveLimiter struct {
+	Strategy    strategies.AdaptiveStrategyInterface
+	RateLimiter *RateLimiter
+	Logger      *slog.Logger
+	// SyncInterval is how often samples are reported and limits refreshed.
+	SyncInterval time.Duration
+
+	mu      sync.Mutex
+	samples map[string]*strategies.HealthSample
+	limits  map[string]int64
+}
+
+func NewAdaptiveLimiter(
+	strategy strategies.AdaptiveStrategyInterface,
+	rateLimiter *RateLimiter,
+	logger *slog.Logger,
+	syncInterval time.Duration,
+) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		Strategy:     strategy,
+		RateLimiter:  rateLimiter,
+		Logger:       logger,
+		SyncInterval: syncInterval,
+		samples:      make(map[string]*strategies.HealthSample),
+		limits:       make(map[string]int64),
+	}
+}
+
+// Observe samples the response of a request allowed by an adaptive rule.
+// Server errors count as errors.
+func (al *AdaptiveLimiter) Observe(descriptor Descriptor, latency time.Duration, status int) {
+	rule, _ := al.RateLimiter.matchRules(func(rule *Rule) bool { return rule.MatchesRoute(descriptor.Method, descriptor.Path) })
+	if rule.Adaptive == nil {
+		return
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	sample, ok := al.samples[rule.Name]
+	if !ok {
+		sample = &strategies.HealthSample{}
+		al.samples[rule.Name] = sample
+	}
+	sample.Requests++
+	sample.Latency += latency
+	if status >= 500 {
+		sample.Errors++
+	}
+}
+
+// Limit returns the current limit of the rule, capping the given one. Rules
+// that are not adaptive, or not synced yet, keep the given limit.
+func (al *AdaptiveLimiter) Limit(rule Rule, limit int64) int64 {
+	if rule.Adaptive == nil {
+		return limit
+	}
+
+	al.mu.Lock()
+	current, ok := al.limits[rule.Name]
+	al.mu.Unlock()
+
+	if !ok {
+		return limit
+	}
+	return min(limit, current)
+}
+
+// Run syncs the adaptive rules until the context is done.
+func (al *AdaptiveLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(al.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			al.Sync(ctx)
+		}
+	}
+}
+
+// Sync reports the samples of every adaptive rule and refreshes their limits.
+// Samples that fail to be reported are dropped.
+func (al *AdaptiveLimiter) Sync(ctx context.Context) {
+	al.mu.Lock()
+	samples := al.samples
+	al.samples = make(map[string]*strategies.HealthSample)
+	al.mu.Unlock()
+
+	for _, rule := range al.RateLimiter.Rules {
+		if rule.Adaptive == nil {
+			continue
+		}
+
+		var sample strategies.HealthSample
+		if taken, ok := samples[rule.Name]; ok {
+			sample = *taken
+		}
+
+		limit, err := al.Strategy.Adapt(ctx, al.adaptRequest(rule), sample)
+		if err != nil {
+			al.Logger.WarnContext(ctx, "adaptive limit sync failed", "rule", rule.Name, "error", err)
+			continue
+		}
+
+		al.mu.Lock()
+		previous, ok := al.limits[rule.Name]
+		al.limits[rule.Name] = limit
+		al.mu.Unlock()
+
+		if ok && previous != limit {
+			al.Logger.InfoContext(ctx, "adaptive limit changed", "rule", rule.Name, "from", previous, "to", limit)
+		}
+	}
+}
+
+// adaptRequest fills the unset settings of the rule: the floor is a single
+// request, the increase a tenth of the rule limit, which is the ceiling, and
+// DefaultAdaptiveMinSamples requests are needed before a decrease.
+func (al *AdaptiveLimiter) adaptRequest(rule Rule) *strategies.AdaptRequest {
+	adaptive := rule.Adaptive
+
+	ceiling := int64(al.RateLimiter.withDefaults(rule).MaxRequests)
+	floor := int64(max(adaptive.MinRequests, 1))
+	decrease := adaptive.Decrease
+	if decrease <= 0 {
+		decrease = DefaultAdaptiveDecrease
+	}
+	increase := int64(adaptive.Increase)
+	if increase <= 0 {
+		increase = max(ceiling/10, 1)
+	}
+	interval := time.Duration(adaptive.IntervalMillis) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultAdaptiveInterval
+	}
+	minSamples := int64(adaptive.MinSamples)
+	if minSamples <= 0 {
+		minSamples = DefaultAdaptiveMinSamples
+	}
+
+	return &strategies.AdaptRequest{
+		Key:        rule.Name,
+		Floor:      min(floor, ceiling),
+		Ceiling:    ceiling,
+		Decrease:   decrease,
+		Increase:   increase,
+		Latency:    time.Duration(adaptive.LatencyMillis) * time.Millisecond,
+		ErrorRate:  adaptive.ErrorRate,
+		Interval:   interval,
+		MinSamples: minSamples,
+	}
+}
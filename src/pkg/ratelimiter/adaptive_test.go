@@ -0,0 +1,97 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeAdaptive records the samples and answers with a fixed limit.
+type fakeAdaptive struct {
+	limit    int64
+	err      error
+	requests []*strategies.AdaptRequest
+	samples  []strategies.HealthSample
+}
+
+func (f *fakeAdaptive) Adapt(ctx context.Context, r *strategies.AdaptRequest, sample strategies.HealthSample) (int64, error) {
+	f.requests = append(f.requests, r)
+	f.samples = append(f.samples, sample)
+	return f.limit, f.err
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	rules := []Rule{
+		{Name: "reports", PathPrefix: "/reports", MaxRequests: 100, Adaptive: &AdaptiveRule{MinRequests: 10, ErrorRate: 0.1}},
+		{Name: "internal", PathPrefix: "/internal", MaxRequests: 50},
+	}
+
+	t.Run("Should report the samples of adaptive rules", func(t *testing.T) {
+		adaptive := &fakeAdaptive{limit: 40}
+		limiter := NewAdaptiveLimiter(adaptive, NewRateLimiter(nil, 10, 1000, rules, discardLogger()), discardLogger(), time.Second)
+
+		limiter.Observe(Descriptor{Method: "GET", Path: "/reports/1"}, 100*time.Millisecond, 200)
+		limiter.Observe(Descriptor{Method: "GET", Path: "/reports/2"}, 300*time.Millisecond, 503)
+		limiter.Observe(Descriptor{Method: "GET", Path: "/internal/jobs"}, time.Second, 500)
+		limiter.Sync(context.Background())
+
+		assert.Equal(t, []*strategies.AdaptRequest{{
+			Key:        "reports",
+			Floor:      10,
+			Ceiling:    100,
+			Decrease:   DefaultAdaptiveDecrease,
+			Increase:   10,
+			ErrorRate:  0.1,
+			Interval:   DefaultAdaptiveInterval,
+			MinSamples: DefaultAdaptiveMinSamples,
+		}}, adaptive.requests)
+		assert.Equal(t, []strategies.HealthSample{{Requests: 2, Errors: 1, Latency: 400 * time.Millisecond}}, adaptive.samples)
+
+		limiter.Sync(context.Background())
+		assert.Equal(t, strategies.HealthSample{}, adaptive.samples[1])
+	})
+
+	t.Run("Should cap the limit of adaptive rules once synced", func(t *testing.T) {
+		adaptive := &fakeAdaptive{limit: 40}
+		limiter := NewAdaptiveLimiter(adaptive, NewRateLimiter(nil, 10, 1000, rules, discardLogger()), discardLogger(), time.Second)
+
+		assert.Equal(t, int64(100), limiter.Limit(rules[0], 100))
+
+		limiter.Sync(context.Background())
+
+		assert.Equal(t, int64(40), limiter.Limit(rules[0], 100))
+		assert.Equal(t, int64(20), limiter.Limit(rules[0], 20))
+		assert.Equal(t, int64(50), limiter.Limit(rules[1], 50))
+	})
+
+	t.Run("Should keep the last limit when the sync fails", func(t *testing.T) {
+		adaptive := &fakeAdaptive{limit: 40}
+		limiter := NewAdaptiveLimiter(adaptive, NewRateLimiter(nil, 10, 1000, rules, discardLogger()), discardLogger(), time.Second)
+
+		limiter.Sync(context.Background())
+		adaptive.limit, adaptive.err = 0, errors.New("connection refused")
+		limiter.Sync(context.Background())
+
+		assert.Equal(t, int64(40), limiter.Limit(rules[0], 100))
+	})
+
+	t.Run("Should apply the adaptive limit to the checks", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		rateLimiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+		rateLimiter.Adaptive = NewAdaptiveLimiter(&fakeAdaptive{limit: 40}, rateLimiter, discardLogger(), time.Second)
+		rateLimiter.Adaptive.Sync(context.Background())
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{Key: "reports:127.0.0.1", Limit: 40, Duration: time.Second}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 40}, nil)
+
+		result, err := rateLimiter.Check(context.Background(), Descriptor{Method: "GET", Path: "/reports/1", ClientIP: "127.0.0.1"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(40), result.Limit)
+		strategyMock.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,52 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+// CounterAdminInterface adjusts the counter of the enforced rule a descriptor
+// is limited by. Shadow rule counters are left alone.
+type CounterAdminInterface interface {
+	Peek(ctx context.Context, descriptor Descriptor) (*strategies.LimitResponse, error)
+	Reset(ctx context.Context, descriptor Descriptor) error
+	SetUsage(ctx context.Context, descriptor Descriptor, used int64) error
+	Grant(ctx context.Context, descriptor Descriptor, bonus int64, ttl time.Duration) error
+}
+
+// Reset clears the current window of the descriptor.
+func (rl *RateLimiter) Reset(ctx context.Context, descriptor Descriptor) error {
+	req, err := rl.adminRequest(ctx, descriptor)
+	if err != nil {
+		return err
+	}
+	return rl.Strategy.Reset(ctx, req)
+}
+
+// SetUsage sets how much of the current window the descriptor has used.
+func (rl *RateLimiter) SetUsage(ctx context.Context, descriptor Descriptor, used int64) error {
+	req, err := rl.adminRequest(ctx, descriptor)
+	if err != nil {
+		return err
+	}
+	return rl.Strategy.SetUsage(ctx, req, used)
+}
+
+// Grant raises the limit of the descriptor by bonus until ttl elapses.
+func (rl *RateLimiter) Grant(ctx context.Context, descriptor Descriptor, bonus int64, ttl time.Duration) error {
+	req, err := rl.adminRequest(ctx, descriptor)
+	if err != nil {
+		return err
+	}
+	return rl.Strategy.Grant(ctx, req, bonus, ttl)
+}
+
+func (rl *RateLimiter) adminRequest(ctx context.Context, descriptor Descriptor) (*strategies.Request, error) {
+	rule, _, id, err := rl.resolve(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	return rl.ruleRequest(rule, id, descriptor), nil
+}
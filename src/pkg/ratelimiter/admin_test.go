@@ -0,0 +1,47 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRateLimiterAdmin(t *testing.T) {
+	rules := []Rule{{Name: "export", PathPrefix: "/export", MaxRequests: 2}}
+	request := &strategies.Request{Key: "export:127.0.0.1", Limit: 2, Duration: time.Second}
+	descriptor := Descriptor{Method: "POST", Path: "/export", ClientIP: "127.0.0.1"}
+
+	t.Run("Should reset the counter of the matching rule", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		strategyMock.On("Reset", mock.Anything, request).Return(nil)
+
+		assert.NoError(t, limiter.Reset(context.Background(), descriptor))
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should set the usage of the matching rule", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		strategyMock.On("SetUsage", mock.Anything, request, int64(1)).Return(nil)
+
+		assert.NoError(t, limiter.SetUsage(context.Background(), descriptor, 1))
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should grant a bonus to the matching rule", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		strategyMock.On("Grant", mock.Anything, request, int64(5), time.Hour).Return(nil)
+
+		assert.NoError(t, limiter.Grant(context.Background(), descriptor, 5, time.Hour))
+		strategyMock.AssertExpectations(t)
+	})
+}
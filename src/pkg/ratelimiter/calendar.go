@@ -0,0 +1,81 @@
+package ratelimiter
+
+import (
+	"time"
+)
+
+const (
+	PeriodHour  = "hour"
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+var defaultCalendar = NewCalendar(time.UTC, time.Now)
+
+func validPeriod(period string) bool {
+	switch period {
+	case "", PeriodHour, PeriodDay, PeriodMonth:
+		return true
+	}
+	return false
+}
+
+// Calendar places the windows of rules with a period on the calendar
+// boundaries of Location, so quotas such as "100k calls per month" reset at
+// the start of the month instead of a window after the first request.
+type Calendar struct {
+	Location *time.Location
+	Now      func() time.Time
+}
+
+func NewCalendar(location *time.Location, now func() time.Time) *Calendar {
+	return &Calendar{
+		Location: location,
+		Now:      now,
+	}
+}
+
+// Window returns the start and the end of the period holding now. Periods
+// start at the top of the hour, at midnight or on the first day of the month,
+// unless an anchor, such as the start of a billing cycle, moves them to its
+// minute, time of day or day of the month. Anchors past the end of a short
+// month start its period on the last day.
+func (c *Calendar) Window(period string, anchor time.Time) (time.Time, time.Time) {
+	now := c.Now().In(c.Location)
+
+	day, hour, minute, second := 1, 0, 0, 0
+	if !anchor.IsZero() {
+		anchor = anchor.In(c.Location)
+		day = anchor.Day()
+		hour, minute, second = anchor.Clock()
+	}
+
+	switch period {
+	case PeriodHour:
+		start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), minute, second, 0, c.Location)
+		if start.After(now) {
+			start = start.Add(-time.Hour)
+		}
+		return start, start.Add(time.Hour)
+	case PeriodDay:
+		start := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, second, 0, c.Location)
+		if start.After(now) {
+			start = time.Date(now.Year(), now.Month(), now.Day()-1, hour, minute, second, 0, c.Location)
+		}
+		return start, time.Date(start.Year(), start.Month(), start.Day()+1, hour, minute, second, 0, c.Location)
+	default:
+		start := c.monthStart(now.Year(), now.Month(), day, hour, minute, second)
+		if start.After(now) {
+			start = c.monthStart(now.Year(), now.Month()-1, day, hour, minute, second)
+		}
+		return start, c.monthStart(start.Year(), start.Month()+1, day, hour, minute, second)
+	}
+}
+
+// monthStart returns the instant of the month at the day and time, keeping
+// days past its end on its last day.
+func (c *Calendar) monthStart(year int, month time.Month, day, hour, minute, second int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, c.Location)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(day, lastDay), hour, minute, second, 0, c.Location)
+}
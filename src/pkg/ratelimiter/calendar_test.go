@@ -0,0 +1,54 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarWindow(t *testing.T) {
+	saoPaulo := time.FixedZone("BRT", -3*60*60)
+	at := func(value string) func() time.Time {
+		instant, _ := time.Parse(time.RFC3339, value)
+		return func() time.Time { return instant }
+	}
+	parse := func(value string) time.Time {
+		instant, _ := time.Parse(time.RFC3339, value)
+		return instant
+	}
+
+	t.Run("Should align the periods to the calendar of the time zone", func(t *testing.T) {
+		calendar := NewCalendar(saoPaulo, at("2024-11-01T01:30:00Z"))
+
+		start, end := calendar.Window(PeriodMonth, time.Time{})
+		assert.True(t, parse("2024-10-01T00:00:00-03:00").Equal(start))
+		assert.True(t, parse("2024-11-01T00:00:00-03:00").Equal(end))
+
+		start, end = calendar.Window(PeriodDay, time.Time{})
+		assert.True(t, parse("2024-10-31T00:00:00-03:00").Equal(start))
+		assert.True(t, parse("2024-11-01T00:00:00-03:00").Equal(end))
+
+		start, end = calendar.Window(PeriodHour, time.Time{})
+		assert.True(t, parse("2024-10-31T22:00:00-03:00").Equal(start))
+		assert.True(t, parse("2024-10-31T23:00:00-03:00").Equal(end))
+	})
+
+	t.Run("Should follow the billing anchor", func(t *testing.T) {
+		calendar := NewCalendar(time.UTC, at("2024-10-10T12:00:00Z"))
+
+		start, end := calendar.Window(PeriodMonth, parse("2024-01-15T08:00:00Z"))
+
+		assert.True(t, parse("2024-09-15T08:00:00Z").Equal(start))
+		assert.True(t, parse("2024-10-15T08:00:00Z").Equal(end))
+	})
+
+	t.Run("Should keep anchors past the end of short months on their last day", func(t *testing.T) {
+		calendar := NewCalendar(time.UTC, at("2024-02-10T12:00:00Z"))
+
+		start, end := calendar.Window(PeriodMonth, parse("2023-12-31T00:00:00Z"))
+
+		assert.True(t, parse("2024-01-31T00:00:00Z").Equal(start))
+		assert.True(t, parse("2024-02-29T00:00:00Z").Equal(end))
+	})
+}
@@ -0,0 +1,98 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+type ConcurrencyLimiterInterface interface {
+	Acquire(ctx context.Context, descriptor Descriptor) (*Slot, error)
+}
+
+// ConcurrencyLimiter caps the requests of a key running at once for the rules
+// with max_concurrent, using the rules and identities of the RateLimiter.
+type ConcurrencyLimiter struct {
+	Strategy    strategies.ConcurrencyStrategyInterface
+	RateLimiter *RateLimiter
+	Lease       time.Duration
+}
+
+func NewConcurrencyLimiter(
+	strategy strategies.ConcurrencyStrategyInterface,
+	rateLimiter *RateLimiter,
+	lease time.Duration,
+) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		Strategy:    strategy,
+		RateLimiter: rateLimiter,
+		Lease:       lease,
+	}
+}
+
+// Acquire takes a slot for the descriptor. It returns a nil slot when the
+// matching rule has no concurrency cap.
+func (cl *ConcurrencyLimiter) Acquire(ctx context.Context, descriptor Descriptor) (*Slot, error) {
+	rule, _, id, err := cl.RateLimiter.resolve(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	if rule.MaxConcurrent <= 0 {
+		return nil, nil
+	}
+
+	request := &strategies.SlotRequest{
+		Key:   cl.RateLimiter.ruleRequest(rule, id, descriptor).Key,
+		Limit: int64(rule.MaxConcurrent),
+		Lease: cl.Lease,
+	}
+
+	result, err := cl.Strategy.Acquire(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Slot{
+		Acquired: result.Acquired,
+		InFlight: result.InFlight,
+		Limit:    result.Limit,
+		Lease:    cl.Lease,
+		Rule:     rule.Name,
+		Key:      id.key,
+		KeyType:  id.keyType,
+		strategy: cl.Strategy,
+		request:  request,
+		id:       result.ID,
+	}, nil
+}
+
+// Slot is a running request. Acquired slots must be released, and renewed
+// while the request runs longer than the lease.
+type Slot struct {
+	Acquired bool
+	InFlight int64
+	Limit    int64
+	Lease    time.Duration
+	Rule     string
+	Key      string
+	KeyType  string
+
+	strategy strategies.ConcurrencyStrategyInterface
+	request  *strategies.SlotRequest
+	id       string
+}
+
+func (s *Slot) Renew(ctx context.Context) error {
+	if !s.Acquired {
+		return nil
+	}
+	return s.strategy.Renew(ctx, s.request, s.id)
+}
+
+func (s *Slot) Release(ctx context.Context) error {
+	if !s.Acquired {
+		return nil
+	}
+	return s.strategy.Release(ctx, s.request, s.id)
+}
@@ -0,0 +1,82 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type ConcurrencyStrategyMock struct {
+	mock.Mock
+}
+
+func (m *ConcurrencyStrategyMock) Acquire(ctx context.Context, r *strategies.SlotRequest) (*strategies.SlotResponse, error) {
+	args := m.Called(ctx, r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.SlotResponse), args.Error(1)
+}
+
+func (m *ConcurrencyStrategyMock) Renew(ctx context.Context, r *strategies.SlotRequest, id string) error {
+	args := m.Called(ctx, r, id)
+	return args.Error(0)
+}
+
+func (m *ConcurrencyStrategyMock) Release(ctx context.Context, r *strategies.SlotRequest, id string) error {
+	args := m.Called(ctx, r, id)
+	return args.Error(0)
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	rules := []Rule{{Name: "reports", PathPrefix: "/reports", MaxConcurrent: 5}}
+	rateLimiter := NewRateLimiter(new(StrategyMock), 10, 1000, rules, discardLogger())
+
+	t.Run("Should take a slot of the matching rule and release it", func(t *testing.T) {
+		strategyMock := new(ConcurrencyStrategyMock)
+		limiter := NewConcurrencyLimiter(strategyMock, rateLimiter, 30*time.Second)
+		request := &strategies.SlotRequest{Key: "reports:127.0.0.1", Limit: 5, Lease: 30 * time.Second}
+
+		strategyMock.On("Acquire", mock.Anything, request).Return(&strategies.SlotResponse{Acquired: true, ID: "slot-1", InFlight: 2, Limit: 5}, nil)
+		strategyMock.On("Release", mock.Anything, request, "slot-1").Return(nil)
+
+		slot, err := limiter.Acquire(context.Background(), Descriptor{Method: "GET", Path: "/reports/1", ClientIP: "127.0.0.1"})
+		require.NoError(t, err)
+
+		assert.True(t, slot.Acquired)
+		assert.Equal(t, int64(2), slot.InFlight)
+		assert.Equal(t, "reports", slot.Rule)
+		assert.NoError(t, slot.Release(context.Background()))
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should not release a slot it did not take", func(t *testing.T) {
+		strategyMock := new(ConcurrencyStrategyMock)
+		limiter := NewConcurrencyLimiter(strategyMock, rateLimiter, 30*time.Second)
+
+		strategyMock.On("Acquire", mock.Anything, mock.Anything).Return(&strategies.SlotResponse{InFlight: 5, Limit: 5}, nil)
+
+		slot, err := limiter.Acquire(context.Background(), Descriptor{Method: "GET", Path: "/reports/1", ClientIP: "127.0.0.1"})
+		require.NoError(t, err)
+
+		assert.False(t, slot.Acquired)
+		assert.NoError(t, slot.Release(context.Background()))
+		strategyMock.AssertNotCalled(t, "Release", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should skip rules without a cap", func(t *testing.T) {
+		strategyMock := new(ConcurrencyStrategyMock)
+		limiter := NewConcurrencyLimiter(strategyMock, rateLimiter, 30*time.Second)
+
+		slot, err := limiter.Acquire(context.Background(), Descriptor{Method: "GET", Path: "/", ClientIP: "127.0.0.1"})
+
+		assert.NoError(t, err)
+		assert.Nil(t, slot)
+		strategyMock.AssertNotCalled(t, "Acquire", mock.Anything, mock.Anything)
+	})
+}
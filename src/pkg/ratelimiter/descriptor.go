@@ -0,0 +1,61 @@
+package ratelimiter
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	rip "github.com/vikram1565/request-ip"
+)
+
+var ErrNoMatchingRule = errors.New("no rule matches the descriptor")
+
+type DescriptorEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Descriptor describes what is limited, independently of the transport.
+// Requests set Method, Path, ClientIP and APIKey and are matched against the
+// route rules. Envoy-style descriptors set Domain and Entries and are matched
+// against the descriptor rules. Limit, Window and Cost, when set, override the
+// rule ones; Cost lets handlers declare how many units a request consumes.
+type Descriptor struct {
+	Method   string
+	Path     string
+	ClientIP string
+	APIKey   string
+	Domain   string
+	Entries  []DescriptorEntry
+	Limit    int64
+	Window   time.Duration
+	Cost     int64
+}
+
+// RequestDescriptor describes an HTTP request, reading the client IP from the
+// forwarding headers and the API key from the API_KEY header.
+func RequestDescriptor(r *http.Request) Descriptor {
+	return Descriptor{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		ClientIP: rip.GetClientIP(r),
+		APIKey:   r.Header.Get(APIKeyHeader),
+	}
+}
+
+// keyPartEscaper escapes the separators of descriptor keys, and the escape
+// character itself, so values holding them cannot collide with other keys.
+var keyPartEscaper = strings.NewReplacer("%", "%25", "|", "%7C", "=", "%3D")
+
+func descriptorKey(descriptor Descriptor) string {
+	var b strings.Builder
+	b.WriteString(keyPartEscaper.Replace(descriptor.Domain))
+	for _, entry := range descriptor.Entries {
+		b.WriteString("|")
+		b.WriteString(keyPartEscaper.Replace(entry.Key))
+		b.WriteString("=")
+		b.WriteString(keyPartEscaper.Replace(entry.Value))
+	}
+	return b.String()
+}
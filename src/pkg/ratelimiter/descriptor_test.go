@@ -0,0 +1,125 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDescriptorKey(t *testing.T) {
+	t.Run("Should not let separators in values collide with other entries", func(t *testing.T) {
+		crafted := descriptorKey(Descriptor{Domain: "edge", Entries: []DescriptorEntry{{Key: "user", Value: "a|plan=free"}}})
+		split := descriptorKey(Descriptor{Domain: "edge", Entries: []DescriptorEntry{{Key: "user", Value: "a"}, {Key: "plan", Value: "free"}}})
+
+		assert.NotEqual(t, split, crafted)
+		assert.Equal(t, "edge|user=a%7Cplan%3Dfree", crafted)
+	})
+}
+
+func TestRateLimiterCheckDescriptor(t *testing.T) {
+	rules := []Rule{
+		{Name: "per-user", Domain: "edge", Descriptor: []DescriptorEntry{{Key: "user"}}, MaxRequests: 3, TimeWindowMillis: 60000},
+		{Name: "checkout", Domain: "edge", Descriptor: []DescriptorEntry{{Key: "path", Value: "/checkout"}}},
+	}
+
+	t.Run("Should check the counter of the matching descriptor value", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{
+			Key:      "per-user:edge|user=alice",
+			Limit:    3,
+			Duration: time.Minute,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 3, Remaining: 2}, nil)
+
+		result, err := limiter.Check(context.Background(), Descriptor{
+			Domain:  "edge",
+			Entries: []DescriptorEntry{{Key: "user", Value: "alice"}},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "per-user", result.Rule)
+		assert.Equal(t, KeyTypeDescriptor, result.KeyType)
+		assert.Equal(t, "edge|user=alice", result.Key)
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should use the global limits and the descriptor override", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{
+			Key:      "checkout:edge|path=/checkout",
+			Limit:    50,
+			Duration: time.Hour,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 50}, nil)
+
+		_, err := limiter.Check(context.Background(), Descriptor{
+			Domain:  "edge",
+			Entries: []DescriptorEntry{{Key: "path", Value: "/checkout"}},
+			Limit:   50,
+			Window:  time.Hour,
+		})
+
+		assert.NoError(t, err)
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should prefer the declared cost over the rule one", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, []Rule{{Name: "export", PathPrefix: "/export", Cost: 100}}, discardLogger())
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{
+			Key:      "export:127.0.0.1",
+			Limit:    10,
+			Duration: time.Second,
+			Cost:     5,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 10, Remaining: 5}, nil)
+
+		_, err := limiter.Check(context.Background(), Descriptor{
+			Method:   "GET",
+			Path:     "/export",
+			ClientIP: "127.0.0.1",
+			Cost:     5,
+		})
+
+		assert.NoError(t, err)
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should return ErrNoMatchingRule when no rule matches", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		_, err := limiter.Check(context.Background(), Descriptor{
+			Domain:  "other",
+			Entries: []DescriptorEntry{{Key: "user", Value: "alice"}},
+		})
+
+		assert.ErrorIs(t, err, ErrNoMatchingRule)
+		strategyMock.AssertNotCalled(t, "CheckLimit", mock.Anything, mock.Anything)
+	})
+}
+
+func TestRuleMatchesDescriptor(t *testing.T) {
+	rule := Rule{Name: "route", Domain: "edge", Descriptor: []DescriptorEntry{{Key: "method", Value: "POST"}, {Key: "path"}}}
+
+	t.Run("Should match the same keys with a wildcard value", func(t *testing.T) {
+		assert.True(t, rule.MatchesDescriptor(Descriptor{Domain: "edge", Entries: []DescriptorEntry{{Key: "method", Value: "POST"}, {Key: "path", Value: "/a"}}}))
+	})
+
+	t.Run("Should not match another value, order or domain", func(t *testing.T) {
+		assert.False(t, rule.MatchesDescriptor(Descriptor{Domain: "edge", Entries: []DescriptorEntry{{Key: "method", Value: "GET"}, {Key: "path", Value: "/a"}}}))
+		assert.False(t, rule.MatchesDescriptor(Descriptor{Domain: "edge", Entries: []DescriptorEntry{{Key: "path", Value: "/a"}, {Key: "method", Value: "POST"}}}))
+		assert.False(t, rule.MatchesDescriptor(Descriptor{Domain: "other", Entries: []DescriptorEntry{{Key: "method", Value: "POST"}, {Key: "path", Value: "/a"}}}))
+	})
+
+	t.Run("Should never match HTTP requests", func(t *testing.T) {
+		assert.False(t, rule.Matches(httptest.NewRequest("POST", "/", nil)))
+	})
+}
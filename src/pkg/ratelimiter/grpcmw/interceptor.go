@@ -0,0 +1,175 @@
+// Package grpcmw rate limits gRPC servers with the same limiter, rules and
+// strategies as the HTTP middleware.
+package grpcmw
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	rip "github.com/vikram1565/request-ip"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+const (
+	DefaultAPIKeyMetadata = "x-api-key"
+
+	LimitMetadata     = "x-ratelimit-limit"
+	RemainingMetadata = "x-ratelimit-remaining"
+	ResetMetadata     = "x-ratelimit-reset"
+)
+
+// Interceptor checks each RPC as an HTTP request to the full method name
+// (e.g. POST /pkg.Service/Method), so rules can match services by path prefix.
+// The key is the API key from metadata when registered, or the peer address.
+type Interceptor struct {
+	Limiter        ratelimiter.RateLimiterInterface
+	APIKeyMetadata string
+	Now            func() time.Time
+	// TrustedProxies lists the peers whose forwarding metadata
+	// (x-forwarded-for, x-real-ip) names the client. Metadata from other
+	// peers is ignored, since any client can set it.
+	TrustedProxies []netip.Prefix
+}
+
+func NewInterceptor(limiter ratelimiter.RateLimiterInterface, apiKeyMetadata string, now func() time.Time) *Interceptor {
+	return &Interceptor{
+		Limiter:        limiter,
+		APIKeyMetadata: apiKeyMetadata,
+		Now:            now,
+	}
+}
+
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		result, err := i.check(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		grpc.SetTrailer(ctx, limitMetadata(result))
+		if result.Result == strategies.Deny {
+			return nil, i.denyError(result)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		result, err := i.check(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		ss.SetTrailer(limitMetadata(result))
+		if result.Result == strategies.Deny {
+			return i.denyError(result)
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (i *Interceptor) check(ctx context.Context, fullMethod string) (*strategies.LimitResponse, error) {
+	result, err := i.Limiter.Check(ctx, i.toDescriptor(ctx, fullMethod))
+	if err != nil {
+		// the underlying error is not exposed to clients
+		return nil, status.Error(codes.Unavailable, "rate limit check failed")
+	}
+
+	return result, nil
+}
+
+// toDescriptor describes the RPC as a request. The client IP is the peer
+// address, or the one in the forwarding metadata of trusted proxies.
+func (i *Interceptor) toDescriptor(ctx context.Context, fullMethod string) ratelimiter.Descriptor {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var clientIP string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		clientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+	}
+	if i.trusted(clientIP) {
+		forwarded := &http.Request{Header: make(http.Header), RemoteAddr: clientIP}
+		for key, values := range md {
+			for _, value := range values {
+				forwarded.Header.Add(key, value)
+			}
+		}
+		clientIP = rip.GetClientIP(forwarded)
+	}
+
+	apiKeyMetadata := i.APIKeyMetadata
+	if apiKeyMetadata == "" {
+		apiKeyMetadata = DefaultAPIKeyMetadata
+	}
+	var apiKey string
+	if values := md.Get(apiKeyMetadata); len(values) > 0 {
+		apiKey = values[0]
+	}
+
+	return ratelimiter.Descriptor{
+		Method:   http.MethodPost,
+		Path:     fullMethod,
+		ClientIP: clientIP,
+		APIKey:   apiKey,
+	}
+}
+
+func (i *Interceptor) trusted(peerIP string) bool {
+	addr, err := netip.ParseAddr(peerIP)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range i.TrustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Interceptor) denyError(result *strategies.LimitResponse) error {
+	retryAfter := result.ExpiresAt.Sub(i.Now())
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	detailed, err := st.WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{
+			{Subject: result.KeyType, Description: "rule " + result.Rule + " allows " + strconv.FormatInt(result.Limit, 10) + " requests"},
+		}},
+	)
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+func limitMetadata(result *strategies.LimitResponse) metadata.MD {
+	return metadata.Pairs(
+		LimitMetadata, strconv.FormatInt(result.Limit, 10),
+		RemainingMetadata, strconv.FormatInt(result.Remaining, 10),
+		ResetMetadata, strconv.FormatInt(result.ExpiresAt.Unix(), 10),
+	)
+}
@@ -0,0 +1,222 @@
+package grpcmw
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+}
+
+type RateLimiterMock struct {
+	mock.Mock
+}
+
+func (m *RateLimiterMock) Check(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *RateLimiterMock) Refund(ctx context.Context, result *strategies.LimitResponse) error {
+	args := m.Called(ctx, result)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) Peek(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+// newHealthClient serves the gRPC health service behind the interceptors.
+func newHealthClient(t *testing.T, limiter *RateLimiterMock) healthpb.HealthClient {
+	listener := bufconn.Listen(1024 * 1024)
+	interceptor := NewInterceptor(limiter, "", mockNow)
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestInterceptorClientIP(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 50051}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+
+	t.Run("Should key on the peer address by default", func(t *testing.T) {
+		interceptor := NewInterceptor(new(RateLimiterMock), "", mockNow)
+
+		descriptor := interceptor.toDescriptor(ctx, "/pkg.Service/Method")
+
+		assert.Equal(t, "10.0.0.5", descriptor.ClientIP)
+	})
+
+	t.Run("Should honor the forwarding metadata of trusted proxies", func(t *testing.T) {
+		interceptor := NewInterceptor(new(RateLimiterMock), "", mockNow)
+		interceptor.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+		descriptor := interceptor.toDescriptor(ctx, "/pkg.Service/Method")
+
+		assert.Equal(t, "203.0.113.7", descriptor.ClientIP)
+	})
+
+	t.Run("Should ignore the forwarding metadata of other peers", func(t *testing.T) {
+		interceptor := NewInterceptor(new(RateLimiterMock), "", mockNow)
+		interceptor.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")}
+
+		descriptor := interceptor.toDescriptor(ctx, "/pkg.Service/Method")
+
+		assert.Equal(t, "10.0.0.5", descriptor.ClientIP)
+	})
+}
+
+func TestInterceptorUnary(t *testing.T) {
+	t.Run("Should allow the call and set the limit trailers", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newHealthClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Method: http.MethodPost,
+			Path:   "/grpc.health.v1.Health/Check",
+			// the address of in-memory connections
+			ClientIP: "bufconn",
+			APIKey:   "abc",
+		}).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     10,
+			Remaining: 9,
+			ExpiresAt: mockNow().Add(time.Minute),
+		}, nil)
+
+		var trailer metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultAPIKeyMetadata, "abc")
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10"}, trailer.Get(LimitMetadata))
+		assert.Equal(t, []string{"9"}, trailer.Get(RemainingMetadata))
+		assert.Equal(t, []string{strconv.FormatInt(mockNow().Add(time.Minute).Unix(), 10)}, trailer.Get(ResetMetadata))
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should return ResourceExhausted with retry info when denied", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newHealthClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Rule:      "default",
+			KeyType:   "ip",
+			Limit:     10,
+			Remaining: 0,
+			ExpiresAt: mockNow().Add(30 * time.Second),
+		}, nil)
+
+		var trailer metadata.MD
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+
+		st := status.Convert(err)
+		assert.Equal(t, codes.ResourceExhausted, st.Code())
+		require.NotEmpty(t, st.Details())
+		retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+		require.True(t, ok)
+		assert.Equal(t, 30*time.Second, retryInfo.RetryDelay.AsDuration())
+		assert.Equal(t, []string{"0"}, trailer.Get(RemainingMetadata))
+	})
+
+	t.Run("Should return Unavailable when the check fails", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newHealthClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, mock.Anything).Return(nil, errors.New("redis unavailable"))
+
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.NotContains(t, err.Error(), "redis")
+	})
+}
+
+func TestInterceptorStream(t *testing.T) {
+	t.Run("Should deny the stream before calling the handler", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newHealthClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, mock.MatchedBy(func(descriptor ratelimiter.Descriptor) bool {
+			return descriptor.Path == "/grpc.health.v1.Health/Watch"
+		})).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Limit:     1,
+			ExpiresAt: mockNow().Add(time.Second),
+		}, nil)
+
+		stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		assert.Equal(t, []string{"1"}, stream.Trailer().Get(LimitMetadata))
+	})
+
+	t.Run("Should allow the stream", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		client := newHealthClient(t, limiter)
+
+		limiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     1,
+			Remaining: 0,
+			ExpiresAt: mockNow().Add(time.Second),
+		}, nil)
+
+		stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		response, err := stream.Recv()
+
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, response.Status)
+	})
+}
@@ -0,0 +1,105 @@
+package httpmw
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+const (
+	ConcurrencyLimitHeader    = "X-Concurrency-Limit"
+	ConcurrencyInFlightHeader = "X-Concurrency-In-Flight"
+)
+
+// ConcurrencyMiddleware holds a slot of the rule while the request runs, and
+// denies it when every slot of its key is taken. Denials and errors go
+// through the Responder and the Observer like those of Middleware.
+type ConcurrencyMiddleware struct {
+	Limiter ratelimiter.ConcurrencyLimiterInterface
+	// Descriptor describes the request, ratelimiter.RequestDescriptor by default.
+	Descriptor func(r *http.Request) ratelimiter.Descriptor
+	Responder  *Responder
+	Observer   Observer
+	Logger     *slog.Logger
+}
+
+func NewConcurrencyMiddleware(limiter ratelimiter.ConcurrencyLimiterInterface) *ConcurrencyMiddleware {
+	return &ConcurrencyMiddleware{
+		Limiter:    limiter,
+		Descriptor: ratelimiter.RequestDescriptor,
+		Responder:  NewResponder(nil, nil, nil),
+		Observer:   NopObserver{},
+		Logger:     slog.Default(),
+	}
+}
+
+func (cm *ConcurrencyMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		descriptor := cm.Descriptor(r)
+
+		slot, err := cm.Limiter.Acquire(ctx, descriptor)
+		if err != nil {
+			cm.Observer.Observe(ctx, descriptor, nil, err)
+			cm.Responder.WriteError(w, r)
+			return
+		}
+		if slot == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(ConcurrencyLimitHeader, strconv.FormatInt(slot.Limit, 10))
+		w.Header().Set(ConcurrencyInFlightHeader, strconv.FormatInt(slot.InFlight, 10))
+
+		if !slot.Acquired {
+			result := &strategies.LimitResponse{
+				Result:  strategies.Deny,
+				Rule:    slot.Rule,
+				Key:     slot.Key,
+				Limit:   slot.Limit,
+				KeyType: slot.KeyType,
+				// running requests give no reset, so clients retry shortly
+				ExpiresAt: cm.Responder.Now().Add(time.Second),
+			}
+			cm.Observer.Observe(ctx, descriptor, result, nil)
+			cm.Responder.WriteDeny(w, r, result)
+			return
+		}
+
+		// the slot is released even when the client goes away
+		defer func() {
+			if err := slot.Release(context.WithoutCancel(ctx)); err != nil {
+				cm.Logger.WarnContext(ctx, "concurrency slot release failed", "rule", slot.Rule, "error", err)
+			}
+		}()
+
+		renewCtx, stopRenewing := context.WithCancel(ctx)
+		defer stopRenewing()
+		go cm.renew(renewCtx, slot)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// renew keeps the lease of a slot alive until the request ends.
+func (cm *ConcurrencyMiddleware) renew(ctx context.Context, slot *ratelimiter.Slot) {
+	ticker := time.NewTicker(slot.Lease / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := slot.Renew(ctx); err != nil && ctx.Err() == nil {
+				cm.Logger.WarnContext(ctx, "concurrency slot renewal failed", "rule", slot.Rule, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSlots hands out a fixed number of slots and records the calls.
+type fakeSlots struct {
+	mu       sync.Mutex
+	free     int64
+	err      error
+	renewals int
+	released []string
+}
+
+func (f *fakeSlots) Acquire(ctx context.Context, r *strategies.SlotRequest) (*strategies.SlotResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.free == 0 {
+		return &strategies.SlotResponse{InFlight: r.Limit, Limit: r.Limit}, nil
+	}
+	f.free--
+	return &strategies.SlotResponse{Acquired: true, ID: "slot-1", InFlight: r.Limit - f.free, Limit: r.Limit}, nil
+}
+
+func (f *fakeSlots) Renew(ctx context.Context, r *strategies.SlotRequest, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewals++
+	return nil
+}
+
+func (f *fakeSlots) Release(ctx context.Context, r *strategies.SlotRequest, id string) error {
+	f.released = append(f.released, id)
+	return nil
+}
+
+func newConcurrencyMiddleware(slots *fakeSlots, lease time.Duration) *ConcurrencyMiddleware {
+	rules := []ratelimiter.Rule{{Name: "reports", PathPrefix: "/reports", MaxConcurrent: 5, DenyStatus: http.StatusServiceUnavailable}}
+	rateLimiter := ratelimiter.NewRateLimiter(nil, 10, 1000, rules, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	limiter := ratelimiter.NewConcurrencyLimiter(slots, rateLimiter, lease)
+	middleware := NewConcurrencyMiddleware(limiter)
+	middleware.Responder = NewResponder(rules, nil, nil)
+	return middleware
+}
+
+func TestConcurrencyMiddlewareHandle(t *testing.T) {
+	t.Run("Should hold a slot while the request runs", func(t *testing.T) {
+		slots := &fakeSlots{free: 3}
+		middleware := newConcurrencyMiddleware(slots, 20*time.Millisecond)
+
+		rr := httptest.NewRecorder()
+		middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, slots.released)
+			time.Sleep(50 * time.Millisecond)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/1", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "5", rr.Header().Get(ConcurrencyLimitHeader))
+		assert.Equal(t, "3", rr.Header().Get(ConcurrencyInFlightHeader))
+		assert.Equal(t, []string{"slot-1"}, slots.released)
+		slots.mu.Lock()
+		assert.Positive(t, slots.renewals)
+		slots.mu.Unlock()
+	})
+
+	t.Run("Should deny with the rule response when every slot is taken", func(t *testing.T) {
+		slots := &fakeSlots{}
+		observer := &recordingObserver{}
+		middleware := newConcurrencyMiddleware(slots, time.Minute)
+		middleware.Observer = observer
+
+		rr := httptest.NewRecorder()
+		middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("next handler must not run")
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/1", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, "5", rr.Header().Get(ConcurrencyInFlightHeader))
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+		assert.Empty(t, slots.released)
+		assert.Len(t, observer.results, 1)
+		assert.Equal(t, "reports", observer.results[0].Rule)
+	})
+
+	t.Run("Should pass requests of rules without a cap", func(t *testing.T) {
+		middleware := newConcurrencyMiddleware(&fakeSlots{err: errors.New("must not be called")}, time.Minute)
+
+		rr := httptest.NewRecorder()
+		middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, rr.Header().Get(ConcurrencyLimitHeader))
+	})
+
+	t.Run("Should answer with the error response when the store fails", func(t *testing.T) {
+		middleware := newConcurrencyMiddleware(&fakeSlots{err: errors.New("redis down")}, time.Minute)
+
+		rr := httptest.NewRecorder()
+		middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("next handler must not run")
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reports/1", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
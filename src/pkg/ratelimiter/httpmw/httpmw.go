@@ -0,0 +1,235 @@
+// Package httpmw rate limits HTTP servers with any ratelimiter.RateLimiterInterface.
+// Denials and errors are answered by a Responder, built with the rules so
+// their deny_status and deny_message are honored, and allowed requests whose
+// response status is refunded by their rule get their quota back.
+//
+// Middleware.Handler is a plain func(http.Handler) http.Handler, usable with
+// net/http and chi (router.Use(mw.Handler)) and with echo through
+// echo.WrapMiddleware(mw.Handler). Frameworks with their own handler types
+// use Allow (gin, echo) or Decide (fasthttp-based ones such as fiber):
+//
+//	// gin
+//	router.Use(func(c *gin.Context) {
+//		if !mw.Allow(c.Writer, c.Request) {
+//			c.Abort()
+//			return
+//		}
+//		c.Next()
+//	})
+//
+//	// fiber
+//	app.Use(func(c *fiber.Ctx) error {
+//		decision := mw.Decide(c.UserContext(), ratelimiter.Descriptor{
+//			Method: c.Method(), Path: c.Path(), ClientIP: c.IP(), APIKey: c.Get("API_KEY"),
+//		})
+//		for key, value := range decision.Header {
+//			c.Set(key, value[0])
+//		}
+//		if !decision.Allowed {
+//			c.Set("Content-Type", decision.ContentType)
+//			return c.Status(decision.Status).Send(decision.Body)
+//		}
+//		err := c.Next()
+//		mw.Finish(c.UserContext(), decision, c.Response().StatusCode())
+//		return err
+//	})
+package httpmw
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+const (
+	LimitHeader      = "X-RateLimit-Limit"
+	RemainingHeader  = "X-RateLimit-Remaining"
+	ResetHeader      = "X-RateLimit-Reset"
+	RetryAfterHeader = "Retry-After"
+	// WouldDenyHeaderName lists the shadow rules that would have denied the
+	// request.
+	WouldDenyHeaderName = "X-RateLimit-Would-Deny"
+)
+
+// Decision is what to answer for a request. Header holds the limit headers,
+// and on denials or errors Status, ContentType and Body hold the response to
+// write.
+type Decision struct {
+	Allowed     bool
+	Status      int
+	Header      http.Header
+	ContentType string
+	Body        []byte
+	Result      *strategies.LimitResponse
+	Err         error
+}
+
+// Observer is told about every decision, to count, log or publish it. Result
+// is nil when err is set.
+type Observer interface {
+	Observe(ctx context.Context, descriptor ratelimiter.Descriptor, result *strategies.LimitResponse, err error)
+}
+
+type NopObserver struct{}
+
+func (NopObserver) Observe(ctx context.Context, descriptor ratelimiter.Descriptor, result *strategies.LimitResponse, err error) {
+}
+
+type Middleware struct {
+	Limiter ratelimiter.RateLimiterInterface
+	// Descriptor describes the request, ratelimiter.RequestDescriptor by default.
+	Descriptor func(r *http.Request) ratelimiter.Descriptor
+	Responder  *Responder
+	// WouldDenyHeader sets WouldDenyHeaderName on requests that shadow rules
+	// would have denied.
+	WouldDenyHeader bool
+	// RefundHeader lets handlers ask for the quota back with RefundHeaderName.
+	RefundHeader bool
+	Observer     Observer
+	Logger       *slog.Logger
+}
+
+func NewMiddleware(limiter ratelimiter.RateLimiterInterface) *Middleware {
+	return &Middleware{
+		Limiter:    limiter,
+		Descriptor: ratelimiter.RequestDescriptor,
+		Responder:  NewResponder(nil, nil, nil),
+		Observer:   NopObserver{},
+		Logger:     slog.Default(),
+	}
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision := m.decideRequest(r)
+		if !writeDecision(w, decision) {
+			return
+		}
+
+		if len(decision.Result.RefundStatuses) == 0 && !m.RefundHeader {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &refundWriter{ResponseWriter: w, status: http.StatusOK, allowHeader: m.RefundHeader}
+		next.ServeHTTP(rw, r)
+		rw.finish()
+
+		if rw.refund || ratelimiter.StatusMatches(decision.Result.RefundStatuses, rw.status) {
+			m.refund(r.Context(), decision.Result, rw.status)
+		}
+	})
+}
+
+// Allow checks the request and sets the limit headers. When the request is
+// not allowed, the response is written and false is returned. Allow never
+// refunds, as the response status is unknown; use Decide and Finish with
+// rules that refund statuses.
+func (m *Middleware) Allow(w http.ResponseWriter, r *http.Request) bool {
+	return writeDecision(w, m.decideRequest(r))
+}
+
+// Decide checks the descriptor and returns the decision without writing
+// anything, for frameworks that are not built on net/http. The response body
+// is problem+json.
+func (m *Middleware) Decide(ctx context.Context, descriptor ratelimiter.Descriptor) Decision {
+	return m.decide(ctx, descriptor, "")
+}
+
+// Finish gives the quota of an allowed decision back when its rule refunds
+// the response status, for callers of Allow and Decide.
+func (m *Middleware) Finish(ctx context.Context, decision Decision, status int) {
+	if decision.Allowed && ratelimiter.StatusMatches(decision.Result.RefundStatuses, status) {
+		m.refund(ctx, decision.Result, status)
+	}
+}
+
+func (m *Middleware) decideRequest(r *http.Request) Decision {
+	return m.decide(r.Context(), m.Descriptor(r), r.Header.Get("Accept"))
+}
+
+// decide checks the descriptor and renders the response in the content type
+// negotiated from accept.
+func (m *Middleware) decide(ctx context.Context, descriptor ratelimiter.Descriptor, accept string) Decision {
+	result, err := m.Limiter.Check(ctx, descriptor)
+	m.Observer.Observe(ctx, descriptor, result, err)
+	if err != nil {
+		// the underlying error is not exposed to clients
+		problem := m.Responder.errorProblem(descriptor.Path)
+		contentType, body := m.Responder.render(accept, problem)
+		return Decision{
+			Status:      problem.Status,
+			Header:      http.Header{"X-Content-Type-Options": {"nosniff"}},
+			ContentType: contentType,
+			Body:        body,
+			Err:         err,
+		}
+	}
+
+	header := http.Header{}
+	header.Set(LimitHeader, strconv.FormatInt(result.Limit, 10))
+	header.Set(RemainingHeader, strconv.FormatInt(max(result.Remaining, 0), 10))
+	header.Set(ResetHeader, strconv.FormatInt(result.ExpiresAt.Unix(), 10))
+	if m.WouldDenyHeader {
+		if wouldDeny := wouldDenyRules(result); len(wouldDeny) > 0 {
+			header.Set(WouldDenyHeaderName, strings.Join(wouldDeny, ", "))
+		}
+	}
+
+	if result.Result != strategies.Deny {
+		return Decision{Allowed: true, Header: header, Result: result}
+	}
+
+	header.Set(RetryAfterHeader, m.Responder.retryAfter(result))
+	header.Set("X-Content-Type-Options", "nosniff")
+	problem := m.Responder.denyProblem(result, descriptor.Path)
+	contentType, body := m.Responder.render(accept, problem)
+
+	return Decision{
+		Status:      problem.Status,
+		Header:      header,
+		ContentType: contentType,
+		Body:        body,
+		Result:      result,
+	}
+}
+
+func (m *Middleware) refund(ctx context.Context, result *strategies.LimitResponse, status int) {
+	// the quota is given back even when the client is gone, and the response
+	// is already written, so refund errors are only logged
+	if err := m.Limiter.Refund(context.WithoutCancel(ctx), result); err != nil {
+		m.Logger.WarnContext(ctx, "rate limiter refund failed", "rule", result.Rule, "status", status, "error", err)
+	}
+}
+
+// writeDecision sets the headers of the decision and, when the request is not
+// allowed, writes its response.
+func writeDecision(w http.ResponseWriter, decision Decision) bool {
+	for key, values := range decision.Header {
+		w.Header()[key] = values
+	}
+	if decision.Allowed {
+		return true
+	}
+
+	w.Header().Set("Content-Type", decision.ContentType)
+	w.WriteHeader(decision.Status)
+	w.Write(decision.Body)
+
+	return false
+}
+
+func wouldDenyRules(result *strategies.LimitResponse) []string {
+	var rules []string
+	for _, shadow := range result.Shadows {
+		if shadow.Result == strategies.Deny {
+			rules = append(rules, shadow.Rule)
+		}
+	}
+	return rules
+}
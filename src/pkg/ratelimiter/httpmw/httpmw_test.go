@@ -0,0 +1,279 @@
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+}
+
+type RateLimiterMock struct {
+	mock.Mock
+}
+
+func (m *RateLimiterMock) Check(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *RateLimiterMock) Refund(ctx context.Context, result *strategies.LimitResponse) error {
+	args := m.Called(ctx, result)
+	return args.Error(0)
+}
+
+func (m *RateLimiterMock) Peek(ctx context.Context, descriptor ratelimiter.Descriptor) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, descriptor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+// recordingObserver keeps the results and errors it is told about.
+type recordingObserver struct {
+	results []*strategies.LimitResponse
+	errs    []error
+}
+
+func (o *recordingObserver) Observe(ctx context.Context, descriptor ratelimiter.Descriptor, result *strategies.LimitResponse, err error) {
+	if err != nil {
+		o.errs = append(o.errs, err)
+		return
+	}
+	o.results = append(o.results, result)
+}
+
+func newMiddleware(limiter *RateLimiterMock) *Middleware {
+	m := NewMiddleware(limiter)
+	m.Responder.Now = mockNow
+	return m
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("success"))
+})
+
+func TestMiddlewareHandler(t *testing.T) {
+	t.Run("Should pass allowed requests with the limit headers", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{
+			Method:   http.MethodGet,
+			Path:     "/items",
+			ClientIP: "192.0.2.1",
+			APIKey:   "abc",
+		}).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     10,
+			Remaining: 4,
+			ExpiresAt: mockNow().Add(time.Minute),
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set("API_KEY", "abc")
+		rr := httptest.NewRecorder()
+
+		newMiddleware(limiter).Handler(okHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "success", rr.Body.String())
+		assert.Equal(t, "10", rr.Header().Get(LimitHeader))
+		assert.Equal(t, "4", rr.Header().Get(RemainingHeader))
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should deny with a problem and Retry-After", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		limiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Rule:      ratelimiter.DefaultRuleName,
+			Limit:     10,
+			Remaining: 0,
+			ExpiresAt: mockNow().Add(30 * time.Second),
+		}, nil)
+
+		rr := httptest.NewRecorder()
+
+		newMiddleware(limiter).Handler(okHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "application/problem+json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "30", rr.Header().Get(RetryAfterHeader))
+		assert.JSONEq(t, `{
+			"type": "about:blank",
+			"title": "Too Many Requests",
+			"status": 429,
+			"detail": "`+DefaultDenyMessage+`",
+			"instance": "/items",
+			"rule": "default",
+			"limit": 10,
+			"remaining": 0,
+			"reset": `+strconv.FormatInt(mockNow().Add(30*time.Second).Unix(), 10)+`
+		}`, rr.Body.String())
+	})
+
+	t.Run("Should deny with the status and message of the rule", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		limiter.On("Check", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Rule:      "export",
+			Limit:     1,
+			ExpiresAt: mockNow().Add(time.Minute),
+		}, nil)
+
+		m := newMiddleware(limiter)
+		m.Responder = NewResponder([]ratelimiter.Rule{{Name: "export", DenyStatus: http.StatusServiceUnavailable, DenyMessage: "exports are paused"}}, nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set("Accept", "text/plain")
+		rr := httptest.NewRecorder()
+
+		m.Handler(okHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, "503 Service Unavailable: exports are paused\n", rr.Body.String())
+	})
+
+	t.Run("Should answer 500 without the error when the check fails", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		limiter.On("Check", mock.Anything, mock.Anything).Return(nil, errors.New("redis unavailable"))
+		observer := &recordingObserver{}
+
+		m := newMiddleware(limiter)
+		m.Observer = observer
+		rr := httptest.NewRecorder()
+
+		m.Handler(okHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "redis")
+		assert.Len(t, observer.errs, 1)
+	})
+
+	t.Run("Should list the shadow rules that would deny", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		result := &strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     10,
+			ExpiresAt: mockNow().Add(time.Minute),
+			Shadows: []*strategies.LimitResponse{
+				{Result: strategies.Deny, Rule: "strict", Shadow: true},
+				{Result: strategies.Allow, Rule: "lenient", Shadow: true},
+			},
+		}
+		limiter.On("Check", mock.Anything, mock.Anything).Return(result, nil)
+		observer := &recordingObserver{}
+
+		m := newMiddleware(limiter)
+		m.WouldDenyHeader = true
+		m.Observer = observer
+		rr := httptest.NewRecorder()
+
+		m.Handler(okHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "strict", rr.Header().Get(WouldDenyHeaderName))
+		assert.Equal(t, []*strategies.LimitResponse{result}, observer.results)
+	})
+
+	t.Run("Should refund responses with a refunded status", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		result := &strategies.LimitResponse{Result: strategies.Allow, Limit: 10, ExpiresAt: mockNow(), RefundStatuses: []string{"5xx"}}
+		limiter.On("Check", mock.Anything, mock.Anything).Return(result, nil)
+		limiter.On("Refund", mock.Anything, result).Return(nil)
+
+		rr := httptest.NewRecorder()
+
+		newMiddleware(limiter).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should use the custom descriptor", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		limiter.On("Check", mock.Anything, ratelimiter.Descriptor{Domain: "edge", Entries: []ratelimiter.DescriptorEntry{{Key: "tenant", Value: "acme"}}}).
+			Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 1, ExpiresAt: mockNow()}, nil)
+
+		m := newMiddleware(limiter)
+		m.Descriptor = func(r *http.Request) ratelimiter.Descriptor {
+			return ratelimiter.Descriptor{Domain: "edge", Entries: []ratelimiter.DescriptorEntry{{Key: "tenant", Value: r.Header.Get("X-Tenant")}}}
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant", "acme")
+		rr := httptest.NewRecorder()
+
+		m.Handler(okHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		limiter.AssertExpectations(t)
+	})
+}
+
+func TestMiddlewareDecide(t *testing.T) {
+	t.Run("Should return the decision without writing", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		result := &strategies.LimitResponse{Result: strategies.Deny, Limit: 1, ExpiresAt: mockNow().Add(time.Second)}
+		limiter.On("Check", mock.Anything, mock.Anything).Return(result, nil)
+
+		decision := newMiddleware(limiter).Decide(context.Background(), ratelimiter.Descriptor{Method: "GET", Path: "/"})
+
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, http.StatusTooManyRequests, decision.Status)
+		assert.Equal(t, "1", decision.Header.Get(RetryAfterHeader))
+		assert.Same(t, result, decision.Result)
+		assert.Equal(t, "application/problem+json; charset=utf-8", decision.ContentType)
+		assert.Contains(t, string(decision.Body), DefaultDenyMessage)
+	})
+}
+
+func TestMiddlewareFinish(t *testing.T) {
+	result := &strategies.LimitResponse{Result: strategies.Allow, Limit: 10, ExpiresAt: mockNow(), RefundStatuses: []string{"503"}}
+
+	t.Run("Should refund allowed decisions with a refunded status", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		limiter.On("Refund", mock.Anything, result).Return(nil)
+
+		newMiddleware(limiter).Finish(context.Background(), Decision{Allowed: true, Result: result}, http.StatusServiceUnavailable)
+
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should refund after the client went away", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+		notCanceled := mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil })
+		limiter.On("Refund", notCanceled, result).Return(nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		newMiddleware(limiter).Finish(ctx, Decision{Allowed: true, Result: result}, http.StatusServiceUnavailable)
+
+		limiter.AssertExpectations(t)
+	})
+
+	t.Run("Should keep the quota of other statuses", func(t *testing.T) {
+		limiter := new(RateLimiterMock)
+
+		newMiddleware(limiter).Finish(context.Background(), Decision{Allowed: true, Result: result}, http.StatusOK)
+
+		limiter.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+}
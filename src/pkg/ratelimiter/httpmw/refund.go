@@ -0,0 +1,68 @@
+package httpmw
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RefundHeaderName is set by handlers, or by upstreams in proxy mode, to tell
+// that the request must not count against the limit. It is removed from the
+// response.
+const RefundHeaderName = "X-RateLimit-Refund"
+
+// refundWriter records the response status and the refund signal while the
+// handler writes the response.
+type refundWriter struct {
+	http.ResponseWriter
+	status      int
+	allowHeader bool
+	refund      bool
+	wroteHeader bool
+}
+
+func (rw *refundWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		rw.status = status
+		rw.takeSignal()
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *refundWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *refundWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *refundWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish reads the signal of handlers that returned without writing, before
+// the server writes their response.
+func (rw *refundWriter) finish() {
+	if !rw.wroteHeader {
+		rw.takeSignal()
+	}
+}
+
+func (rw *refundWriter) takeSignal() {
+	value := rw.Header().Get(RefundHeaderName)
+	if value == "" {
+		return
+	}
+	rw.Header().Del(RefundHeaderName)
+	rw.refund = rw.allowHeader && (value == "1" || strings.EqualFold(value, "true"))
+}
@@ -0,0 +1,274 @@
+package httpmw
+
+import (
+	"bytes"
+	"encoding/json"
+	htmltemplate "html/template"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+const (
+	ContentTypeProblemJSON = "application/problem+json"
+	ContentTypeJSON        = "application/json"
+	ContentTypeHTML        = "text/html"
+	ContentTypeText        = "text/plain"
+
+	DefaultDenyMessage  = "you have reached the maximum number of requests or actions allowed within a certain time frame"
+	DefaultErrorMessage = "unable to verify the request rate limit, try again later"
+)
+
+const defaultHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Detail}}</p>
+</body>
+</html>
+`
+
+const defaultTextTemplate = `{{.Status}} {{.Title}}: {{.Detail}}
+`
+
+// Problem is the RFC 9457 problem details body, extended with the rate limit
+// members when the response is a denial.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	*RateLimitDetails
+}
+
+type RateLimitDetails struct {
+	Rule      string `json:"rule"`
+	Limit     int64  `json:"limit"`
+	Remaining int64  `json:"remaining"`
+	Reset     int64  `json:"reset"`
+}
+
+type RuleResponse struct {
+	Status  int
+	Message string
+}
+
+// Responder writes the denial and error responses, with the deny_status and
+// deny_message of the rule when it has them.
+type Responder struct {
+	Deny         RuleResponse
+	Error        RuleResponse
+	Rules        map[string]RuleResponse
+	HTMLTemplate *htmltemplate.Template
+	TextTemplate *texttemplate.Template
+	Now          func() time.Time
+}
+
+func NewResponder(
+	rules []ratelimiter.Rule,
+	htmlTemplate *htmltemplate.Template,
+	textTemplate *texttemplate.Template,
+) *Responder {
+	if htmlTemplate == nil {
+		htmlTemplate = htmltemplate.Must(htmltemplate.New("deny").Parse(defaultHTMLTemplate))
+	}
+	if textTemplate == nil {
+		textTemplate = texttemplate.Must(texttemplate.New("deny").Parse(defaultTextTemplate))
+	}
+
+	responses := make(map[string]RuleResponse, len(rules))
+	for _, rule := range rules {
+		responses[rule.Name] = RuleResponse{
+			Status:  rule.DenyStatus,
+			Message: rule.DenyMessage,
+		}
+	}
+
+	return &Responder{
+		Deny: RuleResponse{
+			Status:  http.StatusTooManyRequests,
+			Message: DefaultDenyMessage,
+		},
+		Error: RuleResponse{
+			Status:  http.StatusInternalServerError,
+			Message: DefaultErrorMessage,
+		},
+		Rules:        responses,
+		HTMLTemplate: htmlTemplate,
+		TextTemplate: textTemplate,
+		Now:          time.Now,
+	}
+}
+
+// LoadResponder builds a Responder reading the HTML and plain text templates
+// from the given paths. Empty paths keep the built-in templates.
+func LoadResponder(rules []ratelimiter.Rule, htmlPath string, textPath string) (*Responder, error) {
+	var htmlTemplate *htmltemplate.Template
+	var textTemplate *texttemplate.Template
+
+	if htmlPath != "" {
+		content, err := os.ReadFile(htmlPath)
+		if err != nil {
+			return nil, err
+		}
+		if htmlTemplate, err = htmltemplate.New("deny").Parse(string(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if textPath != "" {
+		content, err := os.ReadFile(textPath)
+		if err != nil {
+			return nil, err
+		}
+		if textTemplate, err = texttemplate.New("deny").Parse(string(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewResponder(rules, htmlTemplate, textTemplate), nil
+}
+
+func (rs *Responder) WriteDeny(w http.ResponseWriter, r *http.Request, result *strategies.LimitResponse) {
+	w.Header().Set(RetryAfterHeader, rs.retryAfter(result))
+	rs.write(w, r, rs.denyProblem(result, r.URL.Path))
+}
+
+// WriteError answers with the configured error response. The underlying error
+// is never sent to the client.
+func (rs *Responder) WriteError(w http.ResponseWriter, r *http.Request) {
+	rs.write(w, r, rs.errorProblem(r.URL.Path))
+}
+
+func (rs *Responder) denyProblem(result *strategies.LimitResponse, instance string) Problem {
+	response := rs.Deny
+	if custom, ok := rs.Rules[result.Rule]; ok {
+		if custom.Status != 0 {
+			response.Status = custom.Status
+		}
+		if custom.Message != "" {
+			response.Message = custom.Message
+		}
+	}
+
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(response.Status),
+		Status:   response.Status,
+		Detail:   response.Message,
+		Instance: instance,
+		RateLimitDetails: &RateLimitDetails{
+			Rule:      result.Rule,
+			Limit:     result.Limit,
+			Remaining: max(result.Remaining, 0),
+			Reset:     result.ExpiresAt.Unix(),
+		},
+	}
+}
+
+func (rs *Responder) errorProblem(instance string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(rs.Error.Status),
+		Status:   rs.Error.Status,
+		Detail:   rs.Error.Message,
+		Instance: instance,
+	}
+}
+
+// retryAfter is the Retry-After value of a denial, in whole seconds.
+func (rs *Responder) retryAfter(result *strategies.LimitResponse) string {
+	retryAfter := result.ExpiresAt.Sub(rs.Now())
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return strconv.FormatInt(int64(retryAfter.Round(time.Second)/time.Second), 10)
+}
+
+func (rs *Responder) write(w http.ResponseWriter, r *http.Request, problem Problem) {
+	contentType, body := rs.render(r.Header.Get("Accept"), problem)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	w.Write(body)
+}
+
+// render encodes the problem in the content type negotiated from accept, and
+// returns the Content-Type header value with the body.
+func (rs *Responder) render(accept string, problem Problem) (string, []byte) {
+	contentType := negotiate(accept)
+
+	var body bytes.Buffer
+	switch contentType {
+	case ContentTypeHTML:
+		rs.HTMLTemplate.Execute(&body, problem)
+	case ContentTypeText:
+		rs.TextTemplate.Execute(&body, problem)
+	default:
+		json.NewEncoder(&body).Encode(problem)
+	}
+
+	return contentType + "; charset=utf-8", body.Bytes()
+}
+
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+// negotiate picks the response content type from the Accept header, falling
+// back to problem+json when nothing supported is accepted.
+func negotiate(accept string) string {
+	if accept == "" {
+		return ContentTypeProblemJSON
+	}
+
+	var accepted []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		accepted = append(accepted, acceptedType{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+
+	for _, candidate := range accepted {
+		switch candidate.mediaType {
+		case ContentTypeProblemJSON, "*/*", "application/*":
+			return ContentTypeProblemJSON
+		case ContentTypeJSON:
+			return ContentTypeJSON
+		case ContentTypeHTML:
+			return ContentTypeHTML
+		case ContentTypeText, "text/*":
+			return ContentTypeText
+		}
+	}
+
+	return ContentTypeProblemJSON
+}
@@ -0,0 +1,122 @@
+package httpmw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ContentTypeProblemJSON},
+		{"*/*", ContentTypeProblemJSON},
+		{"application/json", ContentTypeJSON},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", ContentTypeHTML},
+		{"text/plain", ContentTypeText},
+		{"application/json;q=0.5, text/plain;q=0.9", ContentTypeText},
+		{"text/html;q=0", ContentTypeProblemJSON},
+		{"image/png", ContentTypeProblemJSON},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, negotiate(tt.accept), tt.accept)
+	}
+}
+
+func TestResponderWriteDeny(t *testing.T) {
+	rules := []ratelimiter.Rule{
+		{Name: "export", DenyStatus: http.StatusServiceUnavailable, DenyMessage: "exports are paused"},
+	}
+	responder := NewResponder(rules, nil, nil)
+	responder.Now = mockNow
+
+	result := &strategies.LimitResponse{
+		Result:    strategies.Deny,
+		Limit:     10,
+		Remaining: 0,
+		ExpiresAt: mockNow().Add(30 * time.Second),
+		Rule:      ratelimiter.DefaultRuleName,
+	}
+
+	t.Run("Should write problem+json by default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		rr := httptest.NewRecorder()
+
+		responder.WriteDeny(rr, req, result)
+
+		var problem Problem
+		err := json.NewDecoder(rr.Body).Decode(&problem)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+		assert.Equal(t, "application/problem+json; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, http.StatusTooManyRequests, problem.Status)
+		assert.Equal(t, "Too Many Requests", problem.Title)
+		assert.Equal(t, DefaultDenyMessage, problem.Detail)
+		assert.Equal(t, "/orders", problem.Instance)
+		assert.Equal(t, int64(10), problem.Limit)
+		assert.Equal(t, mockNow().Add(30*time.Second).Unix(), problem.Reset)
+	})
+
+	t.Run("Should use the rule status and message", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/export", nil)
+		rr := httptest.NewRecorder()
+
+		exportResult := *result
+		exportResult.Rule = "export"
+		responder.WriteDeny(rr, req, &exportResult)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(t, rr.Body.String(), "exports are paused")
+	})
+
+	t.Run("Should write HTML when accepted", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("Accept", "text/html")
+		rr := httptest.NewRecorder()
+
+		responder.WriteDeny(rr, req, result)
+
+		assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "<h1>Too Many Requests</h1>")
+	})
+
+	t.Run("Should write plain text when accepted", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("Accept", "text/plain")
+		rr := httptest.NewRecorder()
+
+		responder.WriteDeny(rr, req, result)
+
+		assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "429 Too Many Requests: "+DefaultDenyMessage+"\n", rr.Body.String())
+	})
+}
+
+func TestResponderWriteError(t *testing.T) {
+	responder := NewResponder(nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	rr := httptest.NewRecorder()
+
+	responder.WriteError(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Internal Server Error",
+		"status": 500,
+		"detail": "`+DefaultErrorMessage+`",
+		"instance": "/orders"
+	}`, rr.Body.String())
+}
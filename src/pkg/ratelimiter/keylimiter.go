@@ -0,0 +1,167 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+)
+
+var (
+	ErrExceedsLimit = errors.New("requested cost exceeds the limit")
+	ErrNegativeCost = errors.New("requested cost is negative")
+)
+
+// KeyLimiter limits arbitrary keys, such as job or tenant names, with the same
+// shared strategies used by the HTTP limiter, so processes sharing a store
+// share the quota. Its API follows golang.org/x/time/rate.
+type KeyLimiter struct {
+	Strategy strategies.LimiterStrategyInterface
+	// Name prefixes the keys so different limiters do not share counters.
+	Name   string
+	Limit  int64
+	Window time.Duration
+	Now    func() time.Time
+}
+
+func NewKeyLimiter(
+	strategy strategies.LimiterStrategyInterface,
+	name string,
+	limit int64,
+	window time.Duration,
+	now func() time.Time,
+) *KeyLimiter {
+	return &KeyLimiter{
+		Strategy: strategy,
+		Name:     name,
+		Limit:    limit,
+		Window:   window,
+		Now:      now,
+	}
+}
+
+// Allow reports whether one event may happen now for the key.
+func (kl *KeyLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return kl.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n events may happen now for the key. Denied events
+// are not counted.
+func (kl *KeyLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	reservation, err := kl.ReserveN(ctx, key, n)
+	if err != nil {
+		return false, err
+	}
+	return reservation.OK(), nil
+}
+
+// Reserve takes one event for the key if the limit allows it.
+func (kl *KeyLimiter) Reserve(ctx context.Context, key string) (*Reservation, error) {
+	return kl.ReserveN(ctx, key, 1)
+}
+
+// ReserveN takes n events for the key if the limit allows it. Otherwise the
+// reservation holds nothing and its Delay tells when the window resets. Zero
+// events are always allowed without touching the store.
+func (kl *KeyLimiter) ReserveN(ctx context.Context, key string, n int64) (*Reservation, error) {
+	if n < 0 {
+		return nil, ErrNegativeCost
+	}
+	if n > kl.Limit {
+		return nil, ErrExceedsLimit
+	}
+	if n == 0 {
+		return &Reservation{limiter: kl, ok: true}, nil
+	}
+
+	request := &strategies.Request{
+		Key:      kl.Name + ":" + key,
+		Limit:    kl.Limit,
+		Duration: kl.Window,
+		Cost:     n,
+	}
+
+	result, err := kl.Strategy.CheckLimit(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reservation{
+		limiter: kl,
+		request: request,
+		ok:      result.Result == strategies.Allow,
+		resetAt: result.ExpiresAt,
+	}, nil
+}
+
+// Wait blocks until one event is allowed for the key or the context is done.
+func (kl *KeyLimiter) Wait(ctx context.Context, key string) error {
+	return kl.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until n events are allowed for the key or the context is done.
+// Other processes may take the quota first, so it retries at every reset.
+func (kl *KeyLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	for {
+		reservation, err := kl.ReserveN(ctx, key, n)
+		if err != nil {
+			return err
+		}
+		if reservation.OK() {
+			return nil
+		}
+
+		timer := time.NewTimer(max(reservation.Delay(), time.Millisecond))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Reservation is the outcome of ReserveN.
+type Reservation struct {
+	limiter *KeyLimiter
+	request *strategies.Request
+	ok      bool
+	resetAt time.Time
+
+	mu       sync.Mutex
+	canceled bool
+}
+
+// OK reports whether the events were taken.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay is how long to wait before trying again, zero when OK.
+func (r *Reservation) Delay() time.Duration {
+	if r.ok {
+		return 0
+	}
+	return max(r.resetAt.Sub(r.limiter.Now()), 0)
+}
+
+// Cancel gives the events back when they were taken and are not used. It
+// does nothing on denied or already canceled reservations, nor once the window
+// of the reservation has reset, as the events would be refunded to a window
+// that never counted them.
+func (r *Reservation) Cancel(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ok || r.canceled || !r.limiter.Now().Before(r.resetAt) {
+		return nil
+	}
+	if err := r.limiter.Strategy.Refund(ctx, r.request); err != nil {
+		return err
+	}
+	r.canceled = true
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockNow() time.Time {
+	return time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+}
+
+func TestKeyLimiterAllow(t *testing.T) {
+	t.Run("Should count the events against the prefixed key", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{
+			Key:      "exports:tenant-1",
+			Limit:    10,
+			Duration: time.Minute,
+			Cost:     3,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow}, nil)
+
+		allowed, err := limiter.AllowN(context.Background(), "tenant-1", 3)
+
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should not allow when the limit is reached", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+
+		strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{Result: strategies.Deny}, nil)
+
+		allowed, err := limiter.Allow(context.Background(), "tenant-1")
+
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("Should reject costs above the limit", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+
+		_, err := limiter.AllowN(context.Background(), "tenant-1", 11)
+
+		assert.ErrorIs(t, err, ErrExceedsLimit)
+		strategyMock.AssertNotCalled(t, "CheckLimit", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should reject negative costs", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+
+		_, err := limiter.AllowN(context.Background(), "tenant-1", -1)
+
+		assert.ErrorIs(t, err, ErrNegativeCost)
+		strategyMock.AssertNotCalled(t, "CheckLimit", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should allow zero events without counting them", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+
+		reservation, err := limiter.ReserveN(context.Background(), "tenant-1", 0)
+
+		require.NoError(t, err)
+		assert.True(t, reservation.OK())
+		assert.Zero(t, reservation.Delay())
+		assert.NoError(t, reservation.Cancel(context.Background()))
+		strategyMock.AssertNotCalled(t, "CheckLimit", mock.Anything, mock.Anything)
+		strategyMock.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+}
+
+func TestKeyLimiterReserve(t *testing.T) {
+	t.Run("Should refund a canceled reservation once", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+		request := &strategies.Request{Key: "exports:tenant-1", Limit: 10, Duration: time.Minute, Cost: 1}
+
+		strategyMock.On("CheckLimit", mock.Anything, request).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			ExpiresAt: mockNow().Add(time.Minute),
+		}, nil)
+		strategyMock.On("Refund", mock.Anything, request).Return(nil).Once()
+
+		reservation, err := limiter.Reserve(context.Background(), "tenant-1")
+		require.NoError(t, err)
+
+		assert.True(t, reservation.OK())
+		assert.Zero(t, reservation.Delay())
+		assert.NoError(t, reservation.Cancel(context.Background()))
+		assert.NoError(t, reservation.Cancel(context.Background()))
+		strategyMock.AssertNumberOfCalls(t, "Refund", 1)
+	})
+
+	t.Run("Should not refund once the window has reset", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		now := mockNow()
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, func() time.Time { return now })
+
+		strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Allow,
+			ExpiresAt: mockNow().Add(time.Minute),
+		}, nil)
+
+		reservation, err := limiter.Reserve(context.Background(), "tenant-1")
+		require.NoError(t, err)
+
+		now = now.Add(time.Minute)
+		assert.NoError(t, reservation.Cancel(context.Background()))
+		strategyMock.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should delay denied reservations until the reset", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, mockNow)
+
+		strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			ExpiresAt: mockNow().Add(20 * time.Second),
+		}, nil)
+
+		reservation, err := limiter.Reserve(context.Background(), "tenant-1")
+		require.NoError(t, err)
+
+		assert.False(t, reservation.OK())
+		assert.Equal(t, 20*time.Second, reservation.Delay())
+		assert.NoError(t, reservation.Cancel(context.Background()))
+		strategyMock.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+}
+
+func TestKeyLimiterWait(t *testing.T) {
+	t.Run("Should retry after the reset until allowed", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, time.Now)
+
+		strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			ExpiresAt: time.Now().Add(10 * time.Millisecond),
+		}, nil).Once()
+		strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{Result: strategies.Allow}, nil).Once()
+
+		err := limiter.Wait(context.Background(), "tenant-1")
+
+		assert.NoError(t, err)
+		strategyMock.AssertNumberOfCalls(t, "CheckLimit", 2)
+	})
+
+	t.Run("Should stop when the context is done", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewKeyLimiter(strategyMock, "exports", 10, time.Minute, time.Now)
+
+		strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := limiter.Wait(ctx, "tenant-1")
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
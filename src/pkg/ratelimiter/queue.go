@@ -0,0 +1,153 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultQueueSize    = 100
+	DefaultPollInterval = 50 * time.Millisecond
+)
+
+// QueuedRateLimiter delays the requests of rules with max_wait_ms until they
+// fit in the limit, instead of denying them. Waiting requests of a key queue
+// in FIFO order across instances; they are denied when the queue is full, or
+// when the quota would not be back before the wait or the context ends.
+type QueuedRateLimiter struct {
+	*RateLimiter
+	Queue        strategies.QueueStrategyInterface
+	PollInterval time.Duration
+	Now          func() time.Time
+}
+
+func NewQueuedRateLimiter(
+	rateLimiter *RateLimiter,
+	queue strategies.QueueStrategyInterface,
+	now func() time.Time,
+) *QueuedRateLimiter {
+	return &QueuedRateLimiter{
+		RateLimiter:  rateLimiter,
+		Queue:        queue,
+		PollInterval: DefaultPollInterval,
+		Now:          now,
+	}
+}
+
+func (q *QueuedRateLimiter) Check(ctx context.Context, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, "QueuedRateLimiter.Check")
+	defer span.End()
+
+	rule, shadows, id, err := q.resolve(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	if rule.MaxWaitMillis <= 0 {
+		return q.check(ctx, span, rule, shadows, id, descriptor)
+	}
+
+	span.SetAttributes(
+		attribute.String("ratelimiter.rule", rule.Name),
+		attribute.String("ratelimiter.key_type", id.keyType),
+	)
+
+	result, err := q.wait(ctx, span, rule, shadows, id, descriptor)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "rate limit check failed")
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (q *QueuedRateLimiter) wait(ctx context.Context, span trace.Span, rule Rule, shadows []Rule, id identity, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	maxWait := time.Duration(rule.MaxWaitMillis) * time.Millisecond
+	deadline := q.Now().Add(maxWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	queueSize := int64(rule.QueueSize)
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	// no request waits longer than maxWait, so older tickets are stale
+	queue := &strategies.QueueRequest{
+		Key:   q.ruleRequest(rule, id, descriptor).Key,
+		Size:  queueSize,
+		Stale: maxWait + time.Second,
+	}
+
+	ticket, err := q.Queue.Enqueue(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+	if !ticket.Queued {
+		span.AddEvent("queue full")
+		return q.denied(ctx, rule, id, descriptor)
+	}
+	defer q.Queue.Leave(context.WithoutCancel(ctx), queue, ticket.ID)
+
+	for {
+		position, err := q.Queue.Position(ctx, queue, ticket.ID)
+		if err != nil {
+			return nil, err
+		}
+		if position < 0 {
+			return q.denied(ctx, rule, id, descriptor)
+		}
+
+		next := q.Now().Add(q.PollInterval)
+		if position == 0 {
+			result, err := q.checkRule(ctx, rule, id, descriptor)
+			if err != nil {
+				return nil, err
+			}
+			if result.Result == strategies.Allow {
+				span.SetAttributes(attribute.String("ratelimiter.decision", result.Result.String()))
+				q.checkShadows(ctx, span, result, shadows, id, descriptor)
+				return result, nil
+			}
+			// the head waits for the window to reset
+			next = result.ExpiresAt
+			if next.After(deadline) {
+				return result, nil
+			}
+		}
+		if next.After(deadline) {
+			return q.denied(ctx, rule, id, descriptor)
+		}
+
+		timer := time.NewTimer(max(next.Sub(q.Now()), time.Millisecond))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return q.denied(context.WithoutCancel(ctx), rule, id, descriptor)
+		case <-timer.C:
+		}
+	}
+}
+
+// denied returns a denial with the current state of the rule, without
+// counting the request.
+func (q *QueuedRateLimiter) denied(ctx context.Context, rule Rule, id identity, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	result, err := q.Strategy.Peek(ctx, q.ruleRequest(rule, id, descriptor))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Result = strategies.Deny
+	result.Remaining = 0
+	result.Rule = rule.Name
+	result.Key = id.key
+	result.KeyType = id.keyType
+
+	return result, nil
+}
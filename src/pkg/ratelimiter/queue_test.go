@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueue reports the given positions in turn, then keeps the last one.
+type fakeQueue struct {
+	full      bool
+	positions []int64
+	left      []string
+}
+
+func (f *fakeQueue) Enqueue(ctx context.Context, r *strategies.QueueRequest) (*strategies.Ticket, error) {
+	if f.full {
+		return &strategies.Ticket{Position: r.Size}, nil
+	}
+	return &strategies.Ticket{Queued: true, ID: "ticket-1", Position: f.positions[0]}, nil
+}
+
+func (f *fakeQueue) Position(ctx context.Context, r *strategies.QueueRequest, id string) (int64, error) {
+	position := f.positions[0]
+	if len(f.positions) > 1 {
+		f.positions = f.positions[1:]
+	}
+	return position, nil
+}
+
+func (f *fakeQueue) Leave(ctx context.Context, r *strategies.QueueRequest, id string) error {
+	f.left = append(f.left, id)
+	return nil
+}
+
+func TestQueuedRateLimiterCheck(t *testing.T) {
+	rules := []Rule{{Name: "internal", PathPrefix: "/internal", MaxRequests: 2, TimeWindowMillis: 1000, MaxWaitMillis: 200, QueueSize: 10}}
+	descriptor := Descriptor{Method: "GET", Path: "/internal/jobs", ClientIP: "127.0.0.1"}
+	request := &strategies.Request{Key: "internal:127.0.0.1", Limit: 2, Duration: time.Second}
+
+	t.Run("Should wait for the window to reset", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		queue := &fakeQueue{positions: []int64{1, 0}}
+		limiter := NewQueuedRateLimiter(NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger()), queue, time.Now)
+		limiter.PollInterval = time.Millisecond
+
+		strategyMock.On("CheckLimit", mock.Anything, request).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Limit:     2,
+			ExpiresAt: time.Now().Add(20 * time.Millisecond),
+		}, nil).Once()
+		strategyMock.On("CheckLimit", mock.Anything, request).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 2, Remaining: 1}, nil).Once()
+
+		result, err := limiter.Check(context.Background(), descriptor)
+		require.NoError(t, err)
+
+		assert.Equal(t, strategies.Allow, result.Result)
+		assert.Equal(t, "internal", result.Rule)
+		assert.Equal(t, []string{"ticket-1"}, queue.left)
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should deny when the reset comes after the max wait", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		queue := &fakeQueue{positions: []int64{0}}
+		limiter := NewQueuedRateLimiter(NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger()), queue, time.Now)
+
+		strategyMock.On("CheckLimit", mock.Anything, request).Return(&strategies.LimitResponse{
+			Result:    strategies.Deny,
+			Limit:     2,
+			ExpiresAt: time.Now().Add(time.Minute),
+		}, nil).Once()
+
+		result, err := limiter.Check(context.Background(), descriptor)
+		require.NoError(t, err)
+
+		assert.Equal(t, strategies.Deny, result.Result)
+		strategyMock.AssertNumberOfCalls(t, "CheckLimit", 1)
+	})
+
+	t.Run("Should deny without waiting when the queue is full", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewQueuedRateLimiter(NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger()), &fakeQueue{full: true}, time.Now)
+
+		strategyMock.On("Peek", mock.Anything, request).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 2, Total: 2, Remaining: 0}, nil)
+
+		result, err := limiter.Check(context.Background(), descriptor)
+		require.NoError(t, err)
+
+		assert.Equal(t, strategies.Deny, result.Result)
+		assert.Equal(t, "internal", result.Rule)
+		strategyMock.AssertNotCalled(t, "CheckLimit", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Should deny when the context ends while queued", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		queue := &fakeQueue{positions: []int64{3}}
+		limiter := NewQueuedRateLimiter(NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger()), queue, time.Now)
+
+		strategyMock.On("Peek", mock.Anything, request).Return(&strategies.LimitResponse{Limit: 2, Total: 2}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+
+		result, err := limiter.Check(ctx, descriptor)
+		require.NoError(t, err)
+
+		assert.Equal(t, strategies.Deny, result.Result)
+		assert.Equal(t, []string{"ticket-1"}, queue.left)
+	})
+
+	t.Run("Should not queue rules without a max wait", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewQueuedRateLimiter(NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger()), &fakeQueue{full: true}, time.Now)
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{Key: "127.0.0.1", Limit: 10, Duration: time.Second}).Return(&strategies.LimitResponse{Result: strategies.Deny}, nil)
+
+		result, err := limiter.Check(context.Background(), Descriptor{Method: "GET", Path: "/", ClientIP: "127.0.0.1"})
+		require.NoError(t, err)
+
+		assert.Equal(t, strategies.Deny, result.Result)
+	})
+}
@@ -2,67 +2,343 @@ package ratelimiter
 
 import (
 	"context"
-	"net/http"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
-	rip "github.com/vikram1565/request-ip"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	KeyTypeIP         = "ip"
+	KeyTypeToken      = "token"
+	KeyTypeDescriptor = "descriptor"
+
+	APIKeyHeader = "API_KEY"
+
+	TracerName = "github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter"
 )
 
 type RateLimiterInterface interface {
-	Check(ctx context.Context, r *http.Request) (*strategies.LimitResponse, error)
+	Check(ctx context.Context, descriptor Descriptor) (*strategies.LimitResponse, error)
+	// Refund gives back the quota an allowed result consumed.
+	Refund(ctx context.Context, result *strategies.LimitResponse) error
+	// Peek returns the limit state of the descriptor without consuming quota.
+	Peek(ctx context.Context, descriptor Descriptor) (*strategies.LimitResponse, error)
 }
 
 type RateLimiter struct {
 	Strategy         strategies.LimiterStrategyInterface
 	MaxRequestsPerIP int
 	TimeWindowMillis int
+	Rules            []Rule
+	Logger           *slog.Logger
+	// Adaptive, when set, caps the limits of the adaptive rules.
+	Adaptive *AdaptiveLimiter
+	// Calendar places the windows of rules with a period, in UTC when unset.
+	Calendar *Calendar
 }
 
 func NewRateLimiter(
 	strategy strategies.LimiterStrategyInterface,
 	ipMaxReqs int,
 	timeWindow int,
+	rules []Rule,
+	logger *slog.Logger,
 ) *RateLimiter {
 	return &RateLimiter{
 		Strategy:         strategy,
 		MaxRequestsPerIP: ipMaxReqs,
 		TimeWindowMillis: timeWindow,
+		Rules:            rules,
+		Logger:           logger,
 	}
 }
 
-func (rl *RateLimiter) Check(ctx context.Context, r *http.Request) (*strategies.LimitResponse, error) {
-	var key string
-	var limit int64
-	duration := time.Duration(rl.TimeWindowMillis) * time.Millisecond
+// Check applies the first enforced rule matching the descriptor and evaluates
+// the matching shadow rules. Requests without a rule use the default one;
+// descriptors with entries have no default and get ErrNoMatchingRule.
+func (rl *RateLimiter) Check(ctx context.Context, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, "RateLimiter.Check")
+	defer span.End()
 
-	apiKey := r.Header.Get("API_KEY")
+	rule, shadows, id, err := rl.resolve(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
 
-	if apiKey != "" {
-		tokenMaxRequests, err := rl.Strategy.CheckTokenLimit(r.Context(), apiKey)
+	return rl.check(ctx, span, rule, shadows, id, descriptor)
+}
+
+// Peek returns the state of the enforced rule for the descriptor without
+// counting it. Shadow rules are not evaluated.
+func (rl *RateLimiter) Peek(ctx context.Context, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, "RateLimiter.Peek")
+	defer span.End()
+
+	rule, _, id, err := rl.resolve(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			key = rip.GetClientIP(r)
-			limit = int64(rl.MaxRequestsPerIP)
-		} else { // if no token found, set as IP even with API_KEY present
-			key = apiKey
-			limit = tokenMaxRequests
+	req := rl.ruleRequest(rule, id, descriptor)
+	result, err := rl.Strategy.Peek(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "peek failed")
+		return nil, err
+	}
+
+	result.Rule = rule.Name
+	result.Key = id.key
+	result.KeyType = id.keyType
+
+	return result, nil
+}
+
+// resolve finds the rules and the identity the descriptor is limited by,
+// applying its limit and window overrides.
+func (rl *RateLimiter) resolve(ctx context.Context, descriptor Descriptor) (Rule, []Rule, identity, error) {
+	var rule Rule
+	var shadows []Rule
+	var id identity
+	if len(descriptor.Entries) > 0 {
+		rule, shadows = rl.matchRules(func(rule *Rule) bool { return rule.MatchesDescriptor(descriptor) })
+		if rule.Name == DefaultRuleName {
+			return Rule{}, nil, identity{}, ErrNoMatchingRule
 		}
+		id = identity{key: descriptorKey(descriptor), keyType: KeyTypeDescriptor}
 	} else {
-		key = rip.GetClientIP(r)
-		limit = int64(rl.MaxRequestsPerIP)
+		rule, shadows = rl.matchRules(func(rule *Rule) bool { return rule.MatchesRoute(descriptor.Method, descriptor.Path) })
+		id = rl.identify(ctx, descriptor)
+		if id.keyType == KeyTypeToken && hasPeriod(rule, shadows) {
+			id.anchor = rl.tokenAnchor(ctx, id.key)
+		}
 	}
 
-	req := &strategies.Request{
-		Key:      key,
-		Limit:    limit,
-		Duration: duration,
+	if descriptor.Limit > 0 {
+		rule.MaxRequests = int(descriptor.Limit)
+	}
+	if descriptor.Window > 0 {
+		rule.TimeWindowMillis = int(descriptor.Window.Milliseconds())
 	}
 
-	result, err := rl.Strategy.CheckLimit(r.Context(), req)
+	return rule, shadows, id, nil
+}
+
+// check applies the enforced rule and evaluates the shadow ones for the
+// identity, recording the outcome on the span.
+func (rl *RateLimiter) check(ctx context.Context, span trace.Span, rule Rule, shadows []Rule, id identity, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	span.SetAttributes(
+		attribute.String("ratelimiter.rule", rule.Name),
+		attribute.String("ratelimiter.key_type", id.keyType),
+	)
+
+	result, err := rl.checkRule(ctx, rule, id, descriptor)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "rate limit check failed")
 		return nil, err
 	}
 
+	span.SetAttributes(
+		attribute.String("ratelimiter.decision", result.Result.String()),
+		attribute.Int64("ratelimiter.limit", result.Limit),
+		attribute.Int64("ratelimiter.remaining", result.Remaining),
+	)
+
+	rl.checkShadows(ctx, span, result, shadows, id, descriptor)
+
 	return result, nil
 }
+
+// checkShadows evaluates the shadow rules, attaching their results to the
+// enforced one.
+func (rl *RateLimiter) checkShadows(ctx context.Context, span trace.Span, result *strategies.LimitResponse, shadows []Rule, id identity, descriptor Descriptor) {
+	for _, shadow := range shadows {
+		shadowResult, err := rl.checkRule(ctx, shadow, id, descriptor)
+		if err != nil { // shadow rules must never affect the request
+			rl.Logger.WarnContext(ctx, "shadow rule check failed", "rule", shadow.Name, "error", err)
+			continue
+		}
+		shadowResult.Shadow = true
+		result.Shadows = append(result.Shadows, shadowResult)
+
+		if shadowResult.Result == strategies.Deny {
+			span.AddEvent("shadow rule would deny", trace.WithAttributes(
+				attribute.String("ratelimiter.rule", shadowResult.Rule),
+			))
+		}
+	}
+}
+
+type identity struct {
+	key     string
+	keyType string
+	limit   int64 // custom token limit, zero when limiting by IP
+	anchor  time.Time
+}
+
+func (rl *RateLimiter) identify(ctx context.Context, descriptor Descriptor) identity {
+	if descriptor.APIKey != "" {
+		tokenMaxRequests, err := rl.Strategy.CheckTokenLimit(ctx, descriptor.APIKey)
+		if err == nil {
+			return identity{key: descriptor.APIKey, keyType: KeyTypeToken, limit: tokenMaxRequests}
+		}
+	}
+
+	// if no token found, set as IP even with API_KEY present
+	return identity{key: descriptor.ClientIP, keyType: KeyTypeIP}
+}
+
+// tokenAnchor returns the billing cycle start of the token. Periods fall back
+// to the calendar boundaries when it cannot be read.
+func (rl *RateLimiter) tokenAnchor(ctx context.Context, token string) time.Time {
+	anchor, err := rl.Strategy.CheckTokenAnchor(ctx, token)
+	if err != nil {
+		rl.Logger.WarnContext(ctx, "unable to read the token billing anchor", "error", err)
+		return time.Time{}
+	}
+	return anchor
+}
+
+func hasPeriod(rule Rule, shadows []Rule) bool {
+	if rule.Period != "" {
+		return true
+	}
+	for _, shadow := range shadows {
+		if shadow.Period != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (rl *RateLimiter) checkRule(ctx context.Context, rule Rule, id identity, descriptor Descriptor) (*strategies.LimitResponse, error) {
+	req := rl.ruleRequest(rule, id, descriptor)
+
+	result, err := rl.Strategy.CheckLimit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Rule = rule.Name
+	result.Key = id.key
+	result.KeyType = id.keyType
+	result.Request = req
+	result.RefundStatuses = rule.RefundStatuses
+
+	return result, nil
+}
+
+// ruleRequest builds the strategy request counting the identity under the rule.
+func (rl *RateLimiter) ruleRequest(rule Rule, id identity, descriptor Descriptor) *strategies.Request {
+	key := id.key
+	// the limit of a token replaces the global one only, named and shadow
+	// rules keep their own
+	limit := int64(rule.MaxRequests)
+	if rule.Name == DefaultRuleName && id.limit != 0 {
+		limit = id.limit
+	}
+	if rl.Adaptive != nil {
+		limit = rl.Adaptive.Limit(rule, limit)
+	}
+
+	// counters of named rules are kept apart from the default one
+	if rule.Name != DefaultRuleName {
+		key = rule.Name + ":" + key
+	}
+
+	// a cost declared by the caller takes precedence over the rule one
+	cost := descriptor.Cost
+	if cost <= 0 {
+		cost = rule.CostFor(descriptor.Method)
+	}
+
+	request := &strategies.Request{
+		Key:      key,
+		Limit:    limit,
+		Duration: time.Duration(rule.TimeWindowMillis) * time.Millisecond,
+		Cost:     cost,
+	}
+
+	// each calendar period counts on its own key, expiring when it ends
+	if rule.Period != "" {
+		calendar := rl.Calendar
+		if calendar == nil {
+			calendar = defaultCalendar
+		}
+		start, end := calendar.Window(rule.Period, id.anchor)
+		request.Key = key + ":" + strconv.FormatInt(start.Unix(), 10)
+		request.Duration = end.Sub(calendar.Now())
+		request.ResetAt = end
+	}
+
+	return request
+}
+
+// Refund gives back the quota consumed by an allowed result and by its allowed
+// shadow results, so shadow counters keep mirroring the enforced ones.
+func (rl *RateLimiter) Refund(ctx context.Context, result *strategies.LimitResponse) error {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, "RateLimiter.Refund",
+		trace.WithAttributes(attribute.String("ratelimiter.rule", result.Rule)),
+	)
+	defer span.End()
+
+	if result.Result == strategies.Allow && result.Request != nil {
+		if err := rl.Strategy.Refund(ctx, result.Request); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "refund failed")
+			return err
+		}
+	}
+
+	for _, shadow := range result.Shadows {
+		if shadow.Result != strategies.Allow || shadow.Request == nil {
+			continue
+		}
+		if err := rl.Strategy.Refund(ctx, shadow.Request); err != nil {
+			rl.Logger.WarnContext(ctx, "shadow rule refund failed", "rule", shadow.Rule, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// matchRules returns the first enforced rule matching the request, or the
+// default rule when none does, along with every matching shadow rule. Unset
+// limits are filled with the global ones.
+func (rl *RateLimiter) matchRules(matches func(rule *Rule) bool) (Rule, []Rule) {
+	enforced := Rule{Name: DefaultRuleName}
+	var shadows []Rule
+	found := false
+
+	for _, candidate := range rl.Rules {
+		if !matches(&candidate) {
+			continue
+		}
+		if candidate.Shadow {
+			shadows = append(shadows, rl.withDefaults(candidate))
+		} else if !found {
+			enforced = candidate
+			found = true
+		}
+	}
+
+	return rl.withDefaults(enforced), shadows
+}
+
+func (rl *RateLimiter) withDefaults(rule Rule) Rule {
+	if rule.MaxRequests <= 0 {
+		rule.MaxRequests = rl.MaxRequestsPerIP
+	}
+	if rule.TimeWindowMillis <= 0 {
+		rule.TimeWindowMillis = rl.TimeWindowMillis
+	}
+
+	return rule
+}
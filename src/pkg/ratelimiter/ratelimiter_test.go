@@ -1,10 +1,14 @@
 package ratelimiter
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"log/slog"
 	"net"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -12,8 +16,17 @@ import (
 	"github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
 type StrategyMock struct {
 	mock.Mock
 }
@@ -34,11 +47,44 @@ func (m *StrategyMock) CheckTokenLimit(ctx context.Context, token string) (int64
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *StrategyMock) CheckTokenAnchor(ctx context.Context, token string) (time.Time, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *StrategyMock) Refund(ctx context.Context, r *strategies.Request) error {
+	args := m.Called(ctx, r)
+	return args.Error(0)
+}
+
+func (m *StrategyMock) Peek(ctx context.Context, r *strategies.Request) (*strategies.LimitResponse, error) {
+	args := m.Called(ctx, r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strategies.LimitResponse), args.Error(1)
+}
+
+func (m *StrategyMock) Reset(ctx context.Context, r *strategies.Request) error {
+	args := m.Called(ctx, r)
+	return args.Error(0)
+}
+
+func (m *StrategyMock) SetUsage(ctx context.Context, r *strategies.Request, used int64) error {
+	args := m.Called(ctx, r, used)
+	return args.Error(0)
+}
+
+func (m *StrategyMock) Grant(ctx context.Context, r *strategies.Request, bonus int64, ttl time.Duration) error {
+	args := m.Called(ctx, r, bonus, ttl)
+	return args.Error(0)
+}
+
 func TestRateLimiterByIP(t *testing.T) {
 	strategyMock := new(StrategyMock)
 	ipMaxReqs := 5
 	timeWindow := 1000
-	limiter := NewRateLimiter(strategyMock, ipMaxReqs, timeWindow)
+	limiter := NewRateLimiter(strategyMock, ipMaxReqs, timeWindow, nil, discardLogger())
 
 	t.Run("Should deny the request", func(t *testing.T) {
 		ctx := context.Background()
@@ -58,9 +104,9 @@ func TestRateLimiterByIP(t *testing.T) {
 			ExpiresAt: time.Now().Add(time.Duration(timeWindow) * time.Millisecond),
 		}
 
-		strategyMock.On("CheckLimit", ctx, &request).Return(&response, nil)
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&response, nil)
 
-		result, err := limiter.Check(ctx, r)
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
 
 		assert.Nil(t, err)
 		assert.Equal(t, response, *result)
@@ -87,9 +133,9 @@ func TestRateLimiterByIP(t *testing.T) {
 			ExpiresAt: time.Now().Add(time.Duration(timeWindow) * time.Millisecond),
 		}
 
-		strategyMock.On("CheckLimit", ctx, &request).Return(&response, nil)
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&response, nil)
 
-		result, err := limiter.Check(ctx, r)
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
 
 		assert.Nil(t, err)
 		assert.Equal(t, response, *result)
@@ -108,9 +154,9 @@ func TestRateLimiterByIP(t *testing.T) {
 			Duration: time.Duration(timeWindow) * time.Millisecond,
 		}
 
-		strategyMock.On("CheckLimit", ctx, &request).Return(nil, errors.New("error-by-redis-limiter"))
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(nil, errors.New("error-by-redis-limiter"))
 
-		result, err := limiter.Check(ctx, r)
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
 
 		assert.Error(t, err, "error-by-redis-limiter")
 		assert.Nil(t, result)
@@ -122,7 +168,7 @@ func TestRateLimiterByToken(t *testing.T) {
 	strategyMock := new(StrategyMock)
 	ipMaxReqs := 5
 	timeWindow := 1000
-	limiter := NewRateLimiter(strategyMock, ipMaxReqs, timeWindow)
+	limiter := NewRateLimiter(strategyMock, ipMaxReqs, timeWindow, nil, discardLogger())
 
 	t.Run("Should deny the request", func(t *testing.T) {
 		token := "dummy_token"
@@ -144,10 +190,10 @@ func TestRateLimiterByToken(t *testing.T) {
 			ExpiresAt: time.Now().Add(time.Duration(timeWindow) * time.Millisecond),
 		}
 
-		strategyMock.On("CheckTokenLimit", ctx, token).Return(int64(50), nil)
-		strategyMock.On("CheckLimit", ctx, &request).Return(&response, nil)
+		strategyMock.On("CheckTokenLimit", mock.Anything, token).Return(int64(50), nil)
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&response, nil)
 
-		result, err := limiter.Check(ctx, r)
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
 
 		assert.Nil(t, err)
 		assert.Equal(t, response, *result)
@@ -176,10 +222,10 @@ func TestRateLimiterByToken(t *testing.T) {
 			ExpiresAt: time.Now().Add(time.Duration(timeWindow) * time.Millisecond),
 		}
 
-		strategyMock.On("CheckTokenLimit", ctx, token).Return(int64(50), nil)
-		strategyMock.On("CheckLimit", ctx, &request).Return(&response, nil)
+		strategyMock.On("CheckTokenLimit", mock.Anything, token).Return(int64(50), nil)
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&response, nil)
 
-		result, err := limiter.Check(ctx, r)
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
 
 		assert.Nil(t, err)
 		assert.Equal(t, response, *result)
@@ -188,3 +234,297 @@ func TestRateLimiterByToken(t *testing.T) {
 		strategyMock.ExpectedCalls = nil
 	})
 }
+
+func TestRateLimiterByRule(t *testing.T) {
+	strategyMock := new(StrategyMock)
+	ipMaxReqs := 5
+	timeWindow := 1000
+	rules := []Rule{
+		{
+			Name:        "export",
+			PathPrefix:  "/export",
+			Methods:     []string{"POST"},
+			MaxRequests: 2,
+		},
+	}
+	limiter := NewRateLimiter(strategyMock, ipMaxReqs, timeWindow, rules, discardLogger())
+
+	t.Run("Should use the matching rule limit and scope its key", func(t *testing.T) {
+		ctx := context.Background()
+		r := httptest.NewRequest("POST", "/export/users", nil)
+
+		request := strategies.Request{
+			Key:      "export:" + net.ParseIP(strings.Split(r.RemoteAddr, ":")[0]).String(),
+			Limit:    2,
+			Duration: time.Duration(timeWindow) * time.Millisecond,
+		}
+
+		response := strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     2,
+			Total:     1,
+			Remaining: 1,
+			ExpiresAt: time.Now().Add(time.Duration(timeWindow) * time.Millisecond),
+		}
+
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&response, nil)
+
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "export", result.Rule)
+		assert.Equal(t, KeyTypeIP, result.KeyType)
+		strategyMock.AssertExpectations(t)
+
+		strategyMock.ExpectedCalls = nil
+	})
+
+	t.Run("Should fall back to the default rule", func(t *testing.T) {
+		ctx := context.Background()
+		r := httptest.NewRequest("GET", "/export/users", nil)
+
+		request := strategies.Request{
+			Key:      net.ParseIP(strings.Split(r.RemoteAddr, ":")[0]).String(),
+			Limit:    int64(ipMaxReqs),
+			Duration: time.Duration(timeWindow) * time.Millisecond,
+		}
+
+		response := strategies.LimitResponse{
+			Result:    strategies.Allow,
+			Limit:     int64(ipMaxReqs),
+			Total:     1,
+			Remaining: 4,
+			ExpiresAt: time.Now().Add(time.Duration(timeWindow) * time.Millisecond),
+		}
+
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&response, nil)
+
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
+
+		assert.Nil(t, err)
+		assert.Equal(t, DefaultRuleName, result.Rule)
+		strategyMock.AssertExpectations(t)
+
+		strategyMock.ExpectedCalls = nil
+	})
+
+	t.Run("Should keep the rule limit for tokens with their own limit", func(t *testing.T) {
+		ctx := context.Background()
+		r := httptest.NewRequest("POST", "/export/users", nil)
+		r.Header.Set("API_KEY", "dummy_token")
+
+		request := strategies.Request{
+			Key:      "export:dummy_token",
+			Limit:    2,
+			Duration: time.Duration(timeWindow) * time.Millisecond,
+		}
+
+		strategyMock.On("CheckTokenLimit", mock.Anything, "dummy_token").Return(int64(50), nil)
+		strategyMock.On("CheckLimit", mock.Anything, &request).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 2}, nil)
+
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), result.Limit)
+		strategyMock.AssertExpectations(t)
+
+		strategyMock.ExpectedCalls = nil
+	})
+}
+
+func TestRateLimiterShadowRules(t *testing.T) {
+	strategyMock := new(StrategyMock)
+	ipMaxReqs := 5
+	timeWindow := 1000
+	rules := []Rule{
+		{Name: "strict-shadow", PathPrefix: "/", MaxRequests: 1, Shadow: true},
+		{Name: "broken-shadow", PathPrefix: "/", MaxRequests: 1, Shadow: true},
+	}
+	var logs bytes.Buffer
+	limiter := NewRateLimiter(strategyMock, ipMaxReqs, timeWindow, rules, slog.New(slog.NewTextHandler(&logs, nil)))
+
+	t.Run("Should enforce the default rule and report shadow results", func(t *testing.T) {
+		ctx := context.Background()
+		r := httptest.NewRequest("GET", "/", nil)
+		ip := net.ParseIP(strings.Split(r.RemoteAddr, ":")[0]).String()
+		duration := time.Duration(timeWindow) * time.Millisecond
+
+		enforced := strategies.LimitResponse{Result: strategies.Allow, Limit: int64(ipMaxReqs), Total: 2, Remaining: 3}
+		shadow := strategies.LimitResponse{Result: strategies.Deny, Limit: 1, Total: 2, Remaining: 0}
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{Key: ip, Limit: int64(ipMaxReqs), Duration: duration}).Return(&enforced, nil)
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{Key: "strict-shadow:" + ip, Limit: 1, Duration: duration}).Return(&shadow, nil)
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{Key: "broken-shadow:" + ip, Limit: 1, Duration: duration}).Return(nil, errors.New("error-by-redis-limiter"))
+
+		result, err := limiter.Check(ctx, RequestDescriptor(r))
+
+		assert.Nil(t, err)
+		assert.Equal(t, strategies.Allow, result.Result)
+		assert.Equal(t, DefaultRuleName, result.Rule)
+		assert.Len(t, result.Shadows, 1)
+		assert.Equal(t, "strict-shadow", result.Shadows[0].Rule)
+		assert.True(t, result.Shadows[0].Shadow)
+		assert.Equal(t, strategies.Deny, result.Shadows[0].Result)
+		assert.Contains(t, logs.String(), `msg="shadow rule check failed" rule=broken-shadow`)
+		strategyMock.AssertExpectations(t)
+
+		strategyMock.ExpectedCalls = nil
+	})
+}
+
+func TestRateLimiterTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	strategyMock := new(StrategyMock)
+	limiter := NewRateLimiter(strategies.NewTracedStrategy(strategyMock, "mock"), 5, 1000, nil, discardLogger())
+
+	parent, parentSpan := provider.Tracer("test").Start(context.Background(), "incoming")
+	r := httptest.NewRequest("GET", "/", nil)
+
+	strategyMock.On("CheckLimit", mock.Anything, mock.Anything).Return(&strategies.LimitResponse{
+		Result:    strategies.Deny,
+		Limit:     5,
+		Remaining: 0,
+	}, nil)
+
+	_, err := limiter.Check(parent, RequestDescriptor(r))
+	parentSpan.End()
+
+	assert.Nil(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	check := byName["RateLimiter.Check"]
+	assert.Equal(t, parentSpan.SpanContext().TraceID(), check.SpanContext.TraceID())
+	assert.Equal(t, parentSpan.SpanContext().SpanID(), check.Parent.SpanID())
+	assert.Contains(t, check.Attributes, attribute.String("ratelimiter.rule", DefaultRuleName))
+	assert.Contains(t, check.Attributes, attribute.String("ratelimiter.key_type", KeyTypeIP))
+	assert.Contains(t, check.Attributes, attribute.String("ratelimiter.decision", "deny"))
+	assert.Contains(t, check.Attributes, attribute.Int64("ratelimiter.remaining", 0))
+
+	strategySpan := byName["mock.CheckLimit"]
+	assert.Equal(t, check.SpanContext.SpanID(), strategySpan.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindInternal, strategySpan.SpanKind)
+	assert.Contains(t, strategySpan.Attributes, attribute.String("ratelimiter.decision", "deny"))
+}
+
+func TestRateLimiterRefund(t *testing.T) {
+	t.Run("Should refund the allowed enforced and shadow requests", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, nil, discardLogger())
+		enforced := &strategies.Request{Key: "export:127.0.0.1", Limit: 10, Duration: time.Second}
+		shadow := &strategies.Request{Key: "strict:127.0.0.1", Limit: 1, Duration: time.Second}
+
+		strategyMock.On("Refund", mock.Anything, enforced).Return(nil)
+		strategyMock.On("Refund", mock.Anything, shadow).Return(errors.New("error-by-redis-limiter"))
+
+		err := limiter.Refund(context.Background(), &strategies.LimitResponse{
+			Result:  strategies.Allow,
+			Request: enforced,
+			Shadows: []*strategies.LimitResponse{
+				{Result: strategies.Allow, Request: shadow},
+				{Result: strategies.Deny, Request: &strategies.Request{Key: "denied:127.0.0.1"}},
+			},
+		})
+
+		assert.NoError(t, err)
+		strategyMock.AssertNumberOfCalls(t, "Refund", 2)
+	})
+
+	t.Run("Should not refund denied requests", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, nil, discardLogger())
+
+		err := limiter.Refund(context.Background(), &strategies.LimitResponse{
+			Result:  strategies.Deny,
+			Request: &strategies.Request{Key: "127.0.0.1"},
+		})
+
+		assert.NoError(t, err)
+		strategyMock.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything)
+	})
+}
+
+func TestRateLimiterPeek(t *testing.T) {
+	t.Run("Should peek the matching rule counter without shadows", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		rules := []Rule{
+			{Name: "export", PathPrefix: "/export", MaxRequests: 2},
+			{Name: "strict", PathPrefix: "/export", MaxRequests: 1, Shadow: true},
+		}
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+
+		strategyMock.On("Peek", mock.Anything, &strategies.Request{
+			Key:      "export:127.0.0.1",
+			Limit:    2,
+			Duration: time.Second,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, Limit: 2, Total: 1, Remaining: 1}, nil)
+
+		result, err := limiter.Peek(context.Background(), Descriptor{Method: "GET", Path: "/export", ClientIP: "127.0.0.1"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "export", result.Rule)
+		assert.Equal(t, KeyTypeIP, result.KeyType)
+		assert.Empty(t, result.Shadows)
+		strategyMock.AssertNotCalled(t, "CheckLimit", mock.Anything, mock.Anything)
+		strategyMock.AssertExpectations(t)
+	})
+}
+
+func TestRateLimiterCalendarPeriods(t *testing.T) {
+	rules := []Rule{{Name: "plan", PathPrefix: "/api", MaxRequests: 100000, Period: PeriodMonth}}
+	now := time.Date(2024, 10, 24, 3, 0, 0, 0, time.UTC)
+
+	t.Run("Should count the month on its own key until it ends", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+		limiter.Calendar = NewCalendar(time.UTC, func() time.Time { return now })
+		monthStart := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+		monthEnd := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{
+			Key:      "plan:127.0.0.1:" + strconv.FormatInt(monthStart.Unix(), 10),
+			Limit:    100000,
+			Duration: monthEnd.Sub(now),
+			ResetAt:  monthEnd,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow, ExpiresAt: monthEnd}, nil)
+
+		result, err := limiter.Check(context.Background(), Descriptor{Method: "GET", Path: "/api/users", ClientIP: "127.0.0.1"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, monthEnd, result.ExpiresAt)
+		strategyMock.AssertExpectations(t)
+	})
+
+	t.Run("Should follow the billing anchor of the token", func(t *testing.T) {
+		strategyMock := new(StrategyMock)
+		limiter := NewRateLimiter(strategyMock, 10, 1000, rules, discardLogger())
+		limiter.Calendar = NewCalendar(time.UTC, func() time.Time { return now })
+		cycleStart := time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC)
+		cycleEnd := time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC)
+
+		strategyMock.On("CheckTokenLimit", mock.Anything, "dummy_token").Return(int64(500000), nil)
+		strategyMock.On("CheckTokenAnchor", mock.Anything, "dummy_token").Return(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), nil)
+		strategyMock.On("CheckLimit", mock.Anything, &strategies.Request{
+			Key:      "plan:dummy_token:" + strconv.FormatInt(cycleStart.Unix(), 10),
+			Limit:    100000,
+			Duration: cycleEnd.Sub(now),
+			ResetAt:  cycleEnd,
+		}).Return(&strategies.LimitResponse{Result: strategies.Allow}, nil)
+
+		_, err := limiter.Check(context.Background(), Descriptor{Method: "GET", Path: "/api/users", APIKey: "dummy_token"})
+
+		assert.NoError(t, err)
+		strategyMock.AssertExpectations(t)
+	})
+}
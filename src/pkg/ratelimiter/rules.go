@@ -0,0 +1,237 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const DefaultRuleName = "default"
+
+type Rule struct {
+	Name             string   `json:"name"`
+	PathPrefix       string   `json:"path_prefix"`
+	Methods          []string `json:"methods"`
+	MaxRequests      int      `json:"max_requests"`
+	TimeWindowMillis int      `json:"time_window_ms"`
+	DenyStatus       int      `json:"deny_status"`
+	DenyMessage      string   `json:"deny_message"`
+	Shadow           bool     `json:"shadow"`
+	// Period replaces the rolling window with one aligned to the calendar:
+	// "hour", "day" or "month".
+	Period string `json:"period"`
+	// Cost is how many units a matching request consumes, 1 when unset.
+	// MethodCosts overrides it per HTTP method.
+	Cost        int64            `json:"cost"`
+	MethodCosts map[string]int64 `json:"method_costs"`
+	// RefundStatuses gives the quota back when the response status matches a
+	// code ("503") or a class ("5xx").
+	RefundStatuses []string `json:"refund_statuses"`
+	// MaxConcurrent caps the requests of a key running at once, zero for no cap.
+	MaxConcurrent int `json:"max_concurrent"`
+	// MaxWaitMillis makes denied requests wait up to that long for quota, in a
+	// queue of at most QueueSize requests per key, instead of being denied.
+	MaxWaitMillis int `json:"max_wait_ms"`
+	QueueSize     int `json:"queue_size"`
+	// Adaptive lowers and raises MaxRequests with the health of the backend.
+	Adaptive *AdaptiveRule `json:"adaptive"`
+	// Domain and Descriptor make the rule match descriptors (e.g. from Envoy)
+	// instead of HTTP requests.
+	Domain     string            `json:"domain"`
+	Descriptor []DescriptorEntry `json:"descriptor"`
+}
+
+// AdaptiveRule adjusts the limit of a rule with AIMD: every interval the limit
+// is multiplied by Decrease when the error rate or the mean latency of the
+// allowed requests are above ErrorRate or LatencyMillis, and raised by Increase
+// otherwise, between MinRequests and the max_requests of the rule. Intervals
+// with fewer than MinSamples requests never decrease the limit.
+type AdaptiveRule struct {
+	MinRequests    int     `json:"min_requests"`
+	MinSamples     int     `json:"min_samples"`
+	LatencyMillis  int     `json:"latency_ms"`
+	ErrorRate      float64 `json:"error_rate"`
+	Decrease       float64 `json:"decrease"`
+	Increase       int     `json:"increase"`
+	IntervalMillis int     `json:"interval_ms"`
+}
+
+func (adaptive *AdaptiveRule) validate() error {
+	if adaptive.LatencyMillis <= 0 && adaptive.ErrorRate <= 0 {
+		return fmt.Errorf("needs latency_ms or error_rate")
+	}
+	if adaptive.LatencyMillis < 0 || adaptive.ErrorRate < 0 || adaptive.ErrorRate > 1 {
+		return fmt.Errorf("invalid latency_ms or error_rate")
+	}
+	if adaptive.MinRequests < 0 || adaptive.MinSamples < 0 || adaptive.Increase < 0 || adaptive.IntervalMillis < 0 {
+		return fmt.Errorf("negative min_requests, min_samples, increase or interval_ms")
+	}
+	if adaptive.Decrease < 0 || adaptive.Decrease >= 1 {
+		return fmt.Errorf("decrease must be between 0 and 1")
+	}
+	return nil
+}
+
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+func LoadRules(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file RulesFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(file.Rules))
+	for _, rule := range file.Rules {
+		if rule.Name == "" || rule.Name == DefaultRuleName {
+			return nil, fmt.Errorf("invalid rule name %q", rule.Name)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicated rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.DenyStatus != 0 && (rule.DenyStatus < 400 || rule.DenyStatus > 599) {
+			return nil, fmt.Errorf("rule %q with a deny_status outside 400-599", rule.Name)
+		}
+		if len(rule.Descriptor) > 0 && rule.Domain == "" {
+			return nil, fmt.Errorf("descriptor rule %q without domain", rule.Name)
+		}
+		if !validPeriod(rule.Period) {
+			return nil, fmt.Errorf("rule %q with an invalid period %q", rule.Name, rule.Period)
+		}
+		if rule.MaxConcurrent < 0 {
+			return nil, fmt.Errorf("rule %q with a negative max_concurrent", rule.Name)
+		}
+		if rule.MaxWaitMillis < 0 || rule.QueueSize < 0 {
+			return nil, fmt.Errorf("rule %q with a negative max_wait_ms or queue_size", rule.Name)
+		}
+		if rule.Adaptive != nil {
+			if err := rule.Adaptive.validate(); err != nil {
+				return nil, fmt.Errorf("adaptive rule %q: %w", rule.Name, err)
+			}
+		}
+		if rule.Cost < 0 {
+			return nil, fmt.Errorf("rule %q with a negative cost", rule.Name)
+		}
+		for method, cost := range rule.MethodCosts {
+			if cost < 0 {
+				return nil, fmt.Errorf("rule %q with a negative cost for %s", rule.Name, method)
+			}
+		}
+		for _, pattern := range rule.RefundStatuses {
+			if !validStatusPattern(pattern) {
+				return nil, fmt.Errorf("rule %q with an invalid refund status %q", rule.Name, pattern)
+			}
+		}
+		for _, entry := range rule.Descriptor {
+			if entry.Key == "" {
+				return nil, fmt.Errorf("descriptor rule %q with an empty key", rule.Name)
+			}
+		}
+	}
+
+	return file.Rules, nil
+}
+
+// CostFor returns the units a request with the method consumes, zero meaning
+// the single unit of strategies.Request.
+func (rule *Rule) CostFor(method string) int64 {
+	for candidate, cost := range rule.MethodCosts {
+		if cost > 0 && strings.EqualFold(candidate, method) {
+			return cost
+		}
+	}
+	return rule.Cost
+}
+
+func (rule *Rule) Matches(r *http.Request) bool {
+	return rule.MatchesRoute(r.Method, r.URL.Path)
+}
+
+// MatchesRoute reports whether the route rule applies to the method and path.
+// Descriptor rules never match routes.
+func (rule *Rule) MatchesRoute(method string, path string) bool {
+	if len(rule.Descriptor) > 0 {
+		return false
+	}
+
+	if !strings.HasPrefix(path, rule.PathPrefix) {
+		return false
+	}
+
+	if len(rule.Methods) == 0 {
+		return true
+	}
+
+	for _, candidate := range rule.Methods {
+		if strings.EqualFold(candidate, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesDescriptor reports whether the rule applies to the descriptor. Entries
+// must have the same keys in the same order; an empty rule value matches any
+// value, so each value gets its own counter.
+func (rule *Rule) MatchesDescriptor(descriptor Descriptor) bool {
+	if len(rule.Descriptor) == 0 || rule.Domain != descriptor.Domain {
+		return false
+	}
+	if len(rule.Descriptor) != len(descriptor.Entries) {
+		return false
+	}
+
+	for i, entry := range rule.Descriptor {
+		if entry.Key != descriptor.Entries[i].Key {
+			return false
+		}
+		if entry.Value != "" && entry.Value != descriptor.Entries[i].Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// StatusMatches reports whether the status matches one of the patterns, each
+// being a status code ("429") or a class ("5xx").
+func StatusMatches(patterns []string, status int) bool {
+	code := strconv.Itoa(status)
+	for _, pattern := range patterns {
+		if strings.EqualFold(pattern, code) {
+			return true
+		}
+		if len(pattern) == 3 && strings.EqualFold(pattern[1:], "xx") && pattern[0] == code[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validStatusPattern(pattern string) bool {
+	if len(pattern) != 3 || pattern[0] < '1' || pattern[0] > '5' {
+		return false
+	}
+	if strings.EqualFold(pattern[1:], "xx") {
+		return true
+	}
+	_, err := strconv.Atoi(pattern)
+	return err == nil
+}
@@ -0,0 +1,146 @@
+package ratelimiter
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRulesFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRules(t *testing.T) {
+	t.Run("Should return no rules when path is empty", func(t *testing.T) {
+		rules, err := LoadRules("")
+
+		assert.NoError(t, err)
+		assert.Empty(t, rules)
+	})
+
+	t.Run("Should read rules from file", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"export","path_prefix":"/export","methods":["POST"],"max_requests":2,"deny_status":503,"deny_message":"slow down"}]}`)
+
+		rules, err := LoadRules(path)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Rule{
+			{
+				Name:        "export",
+				PathPrefix:  "/export",
+				Methods:     []string{"POST"},
+				MaxRequests: 2,
+				DenyStatus:  503,
+				DenyMessage: "slow down",
+			},
+		}, rules)
+	})
+
+	t.Run("Should reject duplicated rule names", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"a"},{"name":"a"}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject deny statuses that are not errors", func(t *testing.T) {
+		for _, status := range []string{"200", "99", "1000"} {
+			path := writeRulesFile(t, `{"rules":[{"name":"a","deny_status":`+status+`}]}`)
+
+			_, err := LoadRules(path)
+
+			assert.Error(t, err, status)
+		}
+	})
+
+	t.Run("Should reject negative costs", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"a","method_costs":{"POST":-1}}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject invalid refund statuses", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"a","refund_statuses":["5x"]}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject adaptive rules without a health signal", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"a","adaptive":{"min_requests":10,"decrease":0.5}}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject negative adaptive minimum samples", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"a","adaptive":{"error_rate":0.1,"min_samples":-1}}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject unknown periods", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"a","period":"year"}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Should reject reserved rule name", func(t *testing.T) {
+		path := writeRulesFile(t, `{"rules":[{"name":"default"}]}`)
+
+		_, err := LoadRules(path)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestRuleCostFor(t *testing.T) {
+	rule := Rule{Name: "export", Cost: 10, MethodCosts: map[string]int64{"POST": 100}}
+
+	t.Run("Should use the cost of the method", func(t *testing.T) {
+		assert.Equal(t, int64(100), rule.CostFor("post"))
+	})
+
+	t.Run("Should fall back to the rule cost", func(t *testing.T) {
+		assert.Equal(t, int64(10), rule.CostFor("GET"))
+	})
+
+	t.Run("Should leave the cost unset without one", func(t *testing.T) {
+		assert.Zero(t, (&Rule{Name: "plain"}).CostFor("GET"))
+	})
+}
+
+func TestStatusMatches(t *testing.T) {
+	t.Run("Should match codes and classes", func(t *testing.T) {
+		assert.True(t, StatusMatches([]string{"5xx"}, 503))
+		assert.True(t, StatusMatches([]string{"404", "429"}, 429))
+		assert.False(t, StatusMatches([]string{"5xx", "429"}, 200))
+	})
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule := Rule{Name: "export", PathPrefix: "/export", Methods: []string{"post"}}
+
+	assert.True(t, rule.Matches(httptest.NewRequest("POST", "/export/users", nil)))
+	assert.False(t, rule.Matches(httptest.NewRequest("GET", "/export/users", nil)))
+	assert.False(t, rule.Matches(httptest.NewRequest("POST", "/users", nil)))
+
+	anyMethod := Rule{Name: "all", PathPrefix: "/"}
+	assert.True(t, anyMethod.Matches(httptest.NewRequest("DELETE", "/users", nil)))
+}
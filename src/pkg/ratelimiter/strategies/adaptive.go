@@ -0,0 +1,106 @@
+package strategies
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// adaptScript adds the health sample of an instance to the shared one and,
+// once per interval, adjusts the limit: it is multiplied by the decrease
+// factor when the error rate or the mean latency are above their thresholds,
+// and raised by the increase step otherwise. An unhealthy interval with fewer
+// requests than the minimum sample is not trusted, and its samples are kept
+// for the next one. It returns the limit, kept between the floor and the
+// ceiling.
+var adaptScript = redis.NewScript(redisNowMs + `
+local floor = tonumber(ARGV[4])
+local ceiling = tonumber(ARGV[5])
+local limit = tonumber(redis.call("HGET", KEYS[1], "limit") or ceiling)
+
+local requests = redis.call("HINCRBY", KEYS[1], "requests", ARGV[1])
+local errors = redis.call("HINCRBY", KEYS[1], "errors", ARGV[2])
+local latency = redis.call("HINCRBY", KEYS[1], "latency_ms", ARGV[3])
+local since = tonumber(redis.call("HGET", KEYS[1], "since") or nowMs)
+
+if nowMs - since >= tonumber(ARGV[10]) then
+	local errorRate = tonumber(ARGV[9])
+	local maxLatency = tonumber(ARGV[8])
+	local unhealthy = requests > 0 and ((errorRate > 0 and errors / requests > errorRate) or (maxLatency > 0 and latency / requests > maxLatency))
+	if not (unhealthy and requests < tonumber(ARGV[11])) then
+		if unhealthy then
+			limit = math.floor(limit * tonumber(ARGV[6]))
+		elseif requests > 0 then
+			limit = limit + tonumber(ARGV[7])
+		end
+		redis.call("HSET", KEYS[1], "requests", 0, "errors", 0, "latency_ms", 0)
+		since = nowMs
+	end
+end
+
+limit = math.max(floor, math.min(ceiling, limit))
+redis.call("HSET", KEYS[1], "limit", limit, "since", since)
+return limit
+`)
+
+// AdaptRequest describes the adaptive limit of Key. Latency and ErrorRate are
+// the health thresholds, zero meaning the signal is ignored, and MinSamples is
+// how many requests an interval needs before the limit is decreased.
+type AdaptRequest struct {
+	Key        string
+	Floor      int64
+	Ceiling    int64
+	Decrease   float64
+	Increase   int64
+	Latency    time.Duration
+	ErrorRate  float64
+	Interval   time.Duration
+	MinSamples int64
+}
+
+// HealthSample sums what an instance saw from the backend since its last
+// report.
+type HealthSample struct {
+	Requests int64
+	Errors   int64
+	Latency  time.Duration
+}
+
+type AdaptiveStrategyInterface interface {
+	// Adapt reports the sample and returns the current limit.
+	Adapt(ctx context.Context, r *AdaptRequest, sample HealthSample) (int64, error)
+}
+
+// RedisAdaptiveLimiter keeps the adaptive limit and the samples of a key in a
+// hash, so every instance adjusts and reads the same limit.
+type RedisAdaptiveLimiter struct {
+	Client *redis.Client
+}
+
+func NewRedisAdaptiveLimiter(client *redis.Client) *RedisAdaptiveLimiter {
+	return &RedisAdaptiveLimiter{
+		Client: client,
+	}
+}
+
+func (ra *RedisAdaptiveLimiter) Adapt(ctx context.Context, r *AdaptRequest, sample HealthSample) (int64, error) {
+	return adaptScript.Run(ctx, ra.Client, []string{adaptiveKey(r.Key)},
+		sample.Requests,
+		sample.Errors,
+		sample.Latency.Milliseconds(),
+		r.Floor,
+		r.Ceiling,
+		r.Decrease,
+		r.Increase,
+		r.Latency.Milliseconds(),
+		r.ErrorRate,
+		r.Interval.Milliseconds(),
+		r.MinSamples,
+	).Int64()
+}
+
+func adaptiveKey(key string) string {
+	return fmt.Sprintf("adaptive:%s", key)
+}
@@ -0,0 +1,38 @@
+package strategies
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisAdaptiveLimiter(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	strategy := NewRedisAdaptiveLimiter(db)
+
+	t.Run("Should report the sample and return the shared limit", func(t *testing.T) {
+		request := &AdaptRequest{
+			Key:        "reports",
+			Floor:      10,
+			Ceiling:    100,
+			Decrease:   0.5,
+			Increase:   10,
+			Latency:    500 * time.Millisecond,
+			ErrorRate:  0.1,
+			Interval:   10 * time.Second,
+			MinSamples: 20,
+		}
+		clientMock.ExpectEvalSha(adaptScript.Hash(), []string{"adaptive:reports"},
+			int64(20), int64(3), int64(4000), int64(10), int64(100), 0.5, int64(10), int64(500), 0.1, int64(10000), int64(20),
+		).SetVal(int64(50))
+
+		limit, err := strategy.Adapt(context.Background(), request, HealthSample{Requests: 20, Errors: 3, Latency: 4 * time.Second})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(50), limit)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,113 @@
+package strategies
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisNowMs reads the Redis clock, so leases do not depend on the clocks of
+// the instances.
+const redisNowMs = `
+local now = redis.call("TIME")
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+`
+
+// acquireScript drops the expired leases and takes a slot when one is free.
+// It returns whether the slot was taken and how many are in flight.
+var acquireScript = redis.NewScript(redisNowMs + `
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", nowMs)
+local inFlight = redis.call("ZCARD", KEYS[1])
+if inFlight >= tonumber(ARGV[1]) then
+	return {0, inFlight}
+end
+redis.call("ZADD", KEYS[1], nowMs + tonumber(ARGV[2]), ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return {1, inFlight + 1}
+`)
+
+// renewScript extends a lease that has not expired yet.
+var renewScript = redis.NewScript(redisNowMs + `
+if not redis.call("ZSCORE", KEYS[1], ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], "XX", nowMs + tonumber(ARGV[1]), ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+return 1
+`)
+
+// SlotRequest asks for one of the Limit concurrent slots of Key. A slot is
+// leased for Lease and freed when it is not renewed in time.
+type SlotRequest struct {
+	Key   string
+	Limit int64
+	Lease time.Duration
+}
+
+type SlotResponse struct {
+	Acquired bool
+	ID       string
+	InFlight int64
+	Limit    int64
+}
+
+type ConcurrencyStrategyInterface interface {
+	Acquire(ctx context.Context, r *SlotRequest) (*SlotResponse, error)
+	Renew(ctx context.Context, r *SlotRequest, id string) error
+	Release(ctx context.Context, r *SlotRequest, id string) error
+}
+
+// RedisConcurrencyLimiter keeps the slots of a key in a sorted set scored by
+// lease expiry, so slots of crashed instances expire instead of leaking.
+type RedisConcurrencyLimiter struct {
+	Client *redis.Client
+	NewID  func() string
+}
+
+func NewRedisConcurrencyLimiter(client *redis.Client) *RedisConcurrencyLimiter {
+	return &RedisConcurrencyLimiter{
+		Client: client,
+		NewID:  newSlotID,
+	}
+}
+
+func (rcl *RedisConcurrencyLimiter) Acquire(ctx context.Context, r *SlotRequest) (*SlotResponse, error) {
+	id := rcl.NewID()
+	values, err := acquireScript.Run(ctx, rcl.Client, []string{slotsKey(r.Key)}, r.Limit, r.Lease.Milliseconds(), id).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SlotResponse{
+		Acquired: values[0] == 1,
+		InFlight: values[1],
+		Limit:    r.Limit,
+	}
+	if response.Acquired {
+		response.ID = id
+	}
+
+	return response, nil
+}
+
+func (rcl *RedisConcurrencyLimiter) Renew(ctx context.Context, r *SlotRequest, id string) error {
+	return renewScript.Run(ctx, rcl.Client, []string{slotsKey(r.Key)}, r.Lease.Milliseconds(), id).Err()
+}
+
+func (rcl *RedisConcurrencyLimiter) Release(ctx context.Context, r *SlotRequest, id string) error {
+	return rcl.Client.ZRem(ctx, slotsKey(r.Key), id).Err()
+}
+
+func slotsKey(key string) string {
+	return fmt.Sprintf("concurrency:%s", key)
+}
+
+func newSlotID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,50 @@
+package strategies
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisConcurrencyLimiter(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	strategy := NewRedisConcurrencyLimiter(db)
+	strategy.NewID = func() string { return "slot-1" }
+	request := &SlotRequest{Key: "reports:abc", Limit: 5, Lease: 30 * time.Second}
+
+	t.Run("Should take a free slot", func(t *testing.T) {
+		clientMock.ExpectEvalSha(acquireScript.Hash(), []string{"concurrency:reports:abc"}, int64(5), int64(30000), "slot-1").SetVal([]interface{}{int64(1), int64(3)})
+
+		result, err := strategy.Acquire(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.True(t, result.Acquired)
+		assert.Equal(t, "slot-1", result.ID)
+		assert.Equal(t, int64(3), result.InFlight)
+		assert.Equal(t, int64(5), result.Limit)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should not take a slot when all are in flight", func(t *testing.T) {
+		clientMock.ExpectEvalSha(acquireScript.Hash(), []string{"concurrency:reports:abc"}, int64(5), int64(30000), "slot-1").SetVal([]interface{}{int64(0), int64(5)})
+
+		result, err := strategy.Acquire(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.False(t, result.Acquired)
+		assert.Empty(t, result.ID)
+		assert.Equal(t, int64(5), result.InFlight)
+	})
+
+	t.Run("Should renew and release the slot", func(t *testing.T) {
+		clientMock.ExpectEvalSha(renewScript.Hash(), []string{"concurrency:reports:abc"}, int64(30000), "slot-1").SetVal(int64(1))
+		clientMock.ExpectZRem("concurrency:reports:abc", "slot-1").SetVal(1)
+
+		assert.NoError(t, strategy.Renew(context.Background(), request, "slot-1"))
+		assert.NoError(t, strategy.Release(context.Background(), request, "slot-1"))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
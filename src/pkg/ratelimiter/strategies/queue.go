@@ -0,0 +1,93 @@
+package strategies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// enqueueScript drops the stale tickets and adds one at the tail when the
+// queue has room. Tickets are ordered by the Redis clock, so the order is the
+// same on every instance. It returns whether the ticket was added and its
+// position.
+var enqueueScript = redis.NewScript(redisNowMs + `
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", nowMs - tonumber(ARGV[2]))
+local size = redis.call("ZCARD", KEYS[1])
+if size >= tonumber(ARGV[1]) then
+	return {0, size}
+end
+redis.call("ZADD", KEYS[1], nowMs, ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return {1, redis.call("ZRANK", KEYS[1], ARGV[3])}
+`)
+
+// QueueRequest asks for a place in the queue of Key, which holds at most Size
+// tickets. Tickets older than Stale are dropped, so tickets of crashed
+// instances do not block the queue.
+type QueueRequest struct {
+	Key   string
+	Size  int64
+	Stale time.Duration
+}
+
+type Ticket struct {
+	Queued   bool
+	ID       string
+	Position int64
+}
+
+type QueueStrategyInterface interface {
+	Enqueue(ctx context.Context, r *QueueRequest) (*Ticket, error)
+	// Position returns how many tickets are ahead, or -1 when the ticket is
+	// no longer queued.
+	Position(ctx context.Context, r *QueueRequest, id string) (int64, error)
+	Leave(ctx context.Context, r *QueueRequest, id string) error
+}
+
+// RedisQueue keeps the tickets of a key in a sorted set scored by the time
+// they were queued.
+type RedisQueue struct {
+	Client *redis.Client
+	NewID  func() string
+}
+
+func NewRedisQueue(client *redis.Client) *RedisQueue {
+	return &RedisQueue{
+		Client: client,
+		NewID:  newSlotID,
+	}
+}
+
+func (rq *RedisQueue) Enqueue(ctx context.Context, r *QueueRequest) (*Ticket, error) {
+	id := rq.NewID()
+	values, err := enqueueScript.Run(ctx, rq.Client, []string{queueKey(r.Key)}, r.Size, r.Stale.Milliseconds(), id).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := &Ticket{Queued: values[0] == 1, Position: values[1]}
+	if ticket.Queued {
+		ticket.ID = id
+	}
+
+	return ticket, nil
+}
+
+func (rq *RedisQueue) Position(ctx context.Context, r *QueueRequest, id string) (int64, error) {
+	position, err := rq.Client.ZRank(ctx, queueKey(r.Key), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return -1, nil
+	}
+	return position, err
+}
+
+func (rq *RedisQueue) Leave(ctx context.Context, r *QueueRequest, id string) error {
+	return rq.Client.ZRem(ctx, queueKey(r.Key), id).Err()
+}
+
+func queueKey(key string) string {
+	return fmt.Sprintf("queue:%s", key)
+}
@@ -0,0 +1,60 @@
+package strategies
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisQueue(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	queue := NewRedisQueue(db)
+	queue.NewID = func() string { return "ticket-1" }
+	request := &QueueRequest{Key: "internal:127.0.0.1", Size: 10, Stale: 3 * time.Second}
+
+	t.Run("Should queue the ticket at the tail", func(t *testing.T) {
+		clientMock.ExpectEvalSha(enqueueScript.Hash(), []string{"queue:internal:127.0.0.1"}, int64(10), int64(3000), "ticket-1").SetVal([]interface{}{int64(1), int64(2)})
+
+		ticket, err := queue.Enqueue(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.True(t, ticket.Queued)
+		assert.Equal(t, "ticket-1", ticket.ID)
+		assert.Equal(t, int64(2), ticket.Position)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should not queue when the queue is full", func(t *testing.T) {
+		clientMock.ExpectEvalSha(enqueueScript.Hash(), []string{"queue:internal:127.0.0.1"}, int64(10), int64(3000), "ticket-1").SetVal([]interface{}{int64(0), int64(10)})
+
+		ticket, err := queue.Enqueue(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.False(t, ticket.Queued)
+		assert.Empty(t, ticket.ID)
+	})
+
+	t.Run("Should report dropped tickets", func(t *testing.T) {
+		clientMock.ExpectZRank("queue:internal:127.0.0.1", "ticket-1").RedisNil()
+
+		position, err := queue.Position(context.Background(), request, "ticket-1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-1), position)
+	})
+
+	t.Run("Should leave the queue", func(t *testing.T) {
+		clientMock.ExpectZRank("queue:internal:127.0.0.1", "ticket-1").SetVal(0)
+		clientMock.ExpectZRem("queue:internal:127.0.0.1", "ticket-1").SetVal(1)
+
+		position, err := queue.Position(context.Background(), request, "ticket-1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), position)
+		assert.NoError(t, queue.Leave(context.Background(), request, "ticket-1"))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
@@ -14,6 +14,52 @@ const (
 	KeyNotFound   = -2
 )
 
+// checkScript adds the cost to the counter when it fits in the limit, raised
+// by the bonus of the key, and leaves the counter untouched otherwise, so
+// concurrent requests never count more than the limit. A counter without an
+// expiration, such as one just created, gets the window in the same call. It
+// returns whether the cost was taken, the counter, the limit and the time left
+// in the window in milliseconds.
+var checkScript = redis.NewScript(`
+local window = tonumber(ARGV[3])
+local limit = tonumber(ARGV[1]) + math.max(tonumber(redis.call("GET", KEYS[2])) or 0, 0)
+local current = tonumber(redis.call("GET", KEYS[1])) or 0
+local taken = 0
+if current + tonumber(ARGV[2]) <= limit then
+	current = redis.call("INCRBY", KEYS[1], ARGV[2])
+	taken = 1
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -1 then
+	redis.call("PEXPIRE", KEYS[1], window)
+	ttl = window
+elseif ttl == -2 then
+	ttl = window
+end
+return {taken, current, limit, ttl}
+`)
+
+// refundScript lowers the counter without going below zero or touching its
+// expiration. A counter that already expired is left alone.
+var refundScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]))
+if not current then
+	return 0
+end
+local refunded = math.max(current - tonumber(ARGV[1]), 0)
+redis.call("SET", KEYS[1], refunded, "KEEPTTL")
+return refunded
+`)
+
+// setUsageScript sets the counter keeping its expiration, or starting a new
+// window when there is none.
+var setUsageScript = redis.NewScript(`
+if redis.call("PTTL", KEYS[1]) > 0 then
+	return redis.call("SET", KEYS[1], ARGV[1], "KEEPTTL")
+end
+return redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+`)
+
 type RedisLimiter struct {
 	Client *redis.Client
 	Now    func() time.Time
@@ -41,68 +87,135 @@ func (rls *RedisLimiter) CheckTokenLimit(ctx context.Context, token string) (int
 	return tokenMaxRequests, nil
 }
 
-func (rls *RedisLimiter) CheckLimit(ctx context.Context, r *Request) (*LimitResponse, error) {
-	key := fmt.Sprintf("limit:%s", r.Key)
-
-	p := rls.Client.Pipeline()
-	getResult := p.Get(ctx, key)
-	ttlResult := p.TTL(ctx, key)
-
-	if _, err := p.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
-		return nil, err
+func (rls *RedisLimiter) CheckTokenAnchor(ctx context.Context, token string) (time.Time, error) {
+	key := fmt.Sprintf("token_anchor:%s", token)
+	anchor, err := rls.Client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	var ttlDuration time.Duration
-
-	ttl, err := ttlResult.Result()
-	if err != nil || ttl == KeyWithoutTTL || ttl == KeyNotFound {
-		ttlDuration = r.Duration
+	return time.Parse(time.RFC3339, anchor)
+}
 
-		if err := rls.Client.Expire(ctx, key, r.Duration).Err(); err != nil {
-			return nil, err
-		}
-	} else {
-		ttlDuration = ttl
-	}
+func (rls *RedisLimiter) CheckLimit(ctx context.Context, r *Request) (*LimitResponse, error) {
+	key := fmt.Sprintf("limit:%s", r.Key)
 
-	currentCount, err := getResult.Int64()
-	if err != nil && errors.Is(err, redis.Nil) {
-		currentCount = 0
+	// a window under a millisecond would make PEXPIRE delete the counter
+	window := max(r.Duration.Milliseconds(), 1)
+	values, err := checkScript.Run(ctx, rls.Client, []string{key, bonusKey(r.Key)}, r.Limit, r.EffectiveCost(), window).Int64Slice()
+	if err != nil {
+		return nil, err
 	}
+	total, limit := values[1], values[2]
+	ttlDuration := time.Duration(values[3]) * time.Millisecond
 
-	expiresAt := rls.Now().Add(ttlDuration)
+	expiresAt := windowEnd(r, rls.Now().Add(ttlDuration))
 
-	if currentCount >= r.Limit {
+	if values[0] == 0 {
 		return &LimitResponse{
 			Result:    Deny,
-			Total:     currentCount,
-			Limit:     r.Limit,
+			Total:     total,
+			Limit:     limit,
 			Remaining: 0,
 			ExpiresAt: expiresAt,
 		}, nil
 	}
 
-	incrResult := rls.Client.Incr(ctx, key)
-	nextTotal, err := incrResult.Result()
-	if err != nil {
+	return &LimitResponse{
+		Result:    Allow,
+		Total:     total,
+		Limit:     limit,
+		Remaining: limit - total,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (rls *RedisLimiter) Refund(ctx context.Context, r *Request) error {
+	key := fmt.Sprintf("limit:%s", r.Key)
+	return refundScript.Run(ctx, rls.Client, []string{key}, r.EffectiveCost()).Err()
+}
+
+func (rls *RedisLimiter) Peek(ctx context.Context, r *Request) (*LimitResponse, error) {
+	key := fmt.Sprintf("limit:%s", r.Key)
+
+	p := rls.Client.Pipeline()
+	getResult := p.Get(ctx, key)
+	ttlResult := p.TTL(ctx, key)
+	bonusResult := p.Get(ctx, bonusKey(r.Key))
+
+	if _, err := p.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
 		return nil, err
 	}
+	limit := r.Limit + bonusOf(bonusResult)
 
-	if nextTotal > r.Limit {
-		return &LimitResponse{
-			Result:    Deny,
-			Total:     nextTotal,
-			Limit:     r.Limit,
-			Remaining: 0,
-			ExpiresAt: expiresAt,
-		}, nil
+	// a counter without TTL is reset by the next check
+	ttlDuration := r.Duration
+	currentCount, err := getResult.Int64()
+	if err != nil {
+		currentCount = 0
+	}
+	if ttl, err := ttlResult.Result(); err == nil && ttl > 0 {
+		ttlDuration = ttl
+	}
+
+	result := Allow
+	if currentCount+r.EffectiveCost() > limit {
+		result = Deny
 	}
 
 	return &LimitResponse{
-		Result:    Allow,
-		Total:     nextTotal,
-		Limit:     r.Limit,
-		Remaining: r.Limit - nextTotal,
-		ExpiresAt: expiresAt,
+		Result:    result,
+		Total:     currentCount,
+		Limit:     limit,
+		Remaining: max(limit-currentCount, 0),
+		ExpiresAt: windowEnd(r, rls.Now().Add(ttlDuration)),
 	}, nil
 }
+
+func (rls *RedisLimiter) Reset(ctx context.Context, r *Request) error {
+	return rls.Client.Del(ctx, fmt.Sprintf("limit:%s", r.Key)).Err()
+}
+
+func (rls *RedisLimiter) SetUsage(ctx context.Context, r *Request, used int64) error {
+	key := fmt.Sprintf("limit:%s", r.Key)
+	// a window under a millisecond would make SET PX reject the counter
+	window := max(r.Duration.Milliseconds(), 1)
+	return setUsageScript.Run(ctx, rls.Client, []string{key}, used, window).Err()
+}
+
+// Grant adds to the bonus of the key, which expires as a whole ttl after the
+// latest grant.
+func (rls *RedisLimiter) Grant(ctx context.Context, r *Request, bonus int64, ttl time.Duration) error {
+	key := bonusKey(r.Key)
+	_, err := rls.Client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.IncrBy(ctx, key, bonus)
+		p.PExpire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// windowEnd prefers the exact end of calendar windows over the one derived
+// from the TTL, which Redis rounds to seconds.
+func windowEnd(r *Request, fromTTL time.Time) time.Time {
+	if !r.ResetAt.IsZero() {
+		return r.ResetAt
+	}
+	return fromTTL
+}
+
+func bonusKey(key string) string {
+	return fmt.Sprintf("bonus:%s", key)
+}
+
+// bonusOf reads a granted bonus, zero when there is none.
+func bonusOf(cmd *redis.StringCmd) int64 {
+	bonus, err := cmd.Int64()
+	if err != nil || bonus < 0 {
+		return 0
+	}
+	return bonus
+}
@@ -3,6 +3,7 @@ package strategies
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,14 +21,12 @@ func TestRedisLimiterStrategy(t *testing.T) {
 	timeWindow := int64(1000)
 	token := "dummy_token"
 	key := fmt.Sprintf("limit:%s", token)
+	keys := []string{key, fmt.Sprintf("bonus:%s", token)}
 	expectedTTL := time.Duration(timeWindow) * time.Millisecond
 	strategy := NewRedisLimiter(db, mockNow)
 
 	t.Run("Should allow when key is informed for first time", func(t *testing.T) {
-		clientMock.ExpectGet(key).RedisNil()
-		clientMock.ExpectIncr(key).SetVal(1)
-		clientMock.ExpectTTL(key).SetVal(time.Duration(-1))
-		clientMock.ExpectExpire(key, time.Duration(timeWindow)).RedisNil()
+		clientMock.ExpectEvalSha(checkScript.Hash(), keys, int64(ipMaxReqs), int64(1), timeWindow).SetVal([]interface{}{int64(1), int64(1), int64(ipMaxReqs), timeWindow})
 
 		request := &Request{
 			Key:      token,
@@ -44,14 +43,13 @@ func TestRedisLimiterStrategy(t *testing.T) {
 		assert.Equal(t, int64(1), result.Total)
 		assert.Equal(t, int64(ipMaxReqs)-1, result.Remaining)
 		assert.WithinDuration(t, mockNow().Add(expectedTTL), result.ExpiresAt, time.Second)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
 
 		clientMock.ClearExpect()
 	})
 
 	t.Run("Should allow key exists and limit is not reached yet", func(t *testing.T) {
-		clientMock.ExpectGet(key).SetVal("1")
-		clientMock.ExpectTTL(key).SetVal(expectedTTL)
-		clientMock.ExpectIncr(key).SetVal(2)
+		clientMock.ExpectEvalSha(checkScript.Hash(), keys, int64(ipMaxReqs), int64(1), timeWindow).SetVal([]interface{}{int64(1), int64(2), int64(ipMaxReqs), timeWindow})
 
 		request := &Request{
 			Key:      token,
@@ -73,9 +71,7 @@ func TestRedisLimiterStrategy(t *testing.T) {
 	})
 
 	t.Run("Should allow key exists and limit is reached", func(t *testing.T) {
-		clientMock.ExpectGet(key).SetVal(fmt.Sprint(ipMaxReqs))
-		clientMock.ExpectTTL(key).SetVal(expectedTTL)
-		clientMock.ExpectIncr(key).SetVal(2)
+		clientMock.ExpectEvalSha(checkScript.Hash(), keys, int64(ipMaxReqs), int64(1), timeWindow).SetVal([]interface{}{int64(0), int64(ipMaxReqs), int64(ipMaxReqs), timeWindow})
 
 		request := &Request{
 			Key:      token,
@@ -95,4 +91,238 @@ func TestRedisLimiterStrategy(t *testing.T) {
 
 		clientMock.ClearExpect()
 	})
+
+	t.Run("Should deny without counting when the cost does not fit", func(t *testing.T) {
+		clientMock.ExpectEvalSha(checkScript.Hash(), keys, int64(ipMaxReqs), int64(3), timeWindow).SetVal([]interface{}{int64(0), int64(3), int64(ipMaxReqs), timeWindow})
+
+		request := &Request{
+			Key:      token,
+			Limit:    int64(ipMaxReqs),
+			Duration: time.Duration(timeWindow) * time.Millisecond,
+			Cost:     3,
+		}
+
+		result, err := strategy.CheckLimit(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Deny, result.Result)
+		assert.Equal(t, int64(3), result.Total)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+
+		clientMock.ClearExpect()
+	})
+
+	t.Run("Should count the cost of the request", func(t *testing.T) {
+		clientMock.ExpectEvalSha(checkScript.Hash(), keys, int64(ipMaxReqs), int64(3), timeWindow).SetVal([]interface{}{int64(1), int64(4), int64(ipMaxReqs), timeWindow})
+
+		request := &Request{
+			Key:      token,
+			Limit:    int64(ipMaxReqs),
+			Duration: time.Duration(timeWindow) * time.Millisecond,
+			Cost:     3,
+		}
+
+		result, err := strategy.CheckLimit(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Allow, result.Result)
+		assert.Equal(t, int64(4), result.Total)
+		assert.Equal(t, int64(1), result.Remaining)
+
+		clientMock.ClearExpect()
+	})
+}
+
+func TestRedisLimiterConcurrentCosts(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	clientMock.MatchExpectationsInOrder(false)
+	strategy := NewRedisLimiter(db, mockNow)
+	keys := []string{"limit:export", "bonus:export"}
+
+	t.Run("Should take the cost of concurrent requests in a single script call each", func(t *testing.T) {
+		// with a limit of 5 only one of the requests costing 3 fits, and the
+		// script decides it without a separate read
+		replies := [][]interface{}{
+			{int64(1), int64(3), int64(5), int64(60000)},
+			{int64(0), int64(3), int64(5), int64(60000)},
+			{int64(0), int64(3), int64(5), int64(60000)},
+			{int64(0), int64(3), int64(5), int64(60000)},
+		}
+		for _, reply := range replies {
+			clientMock.ExpectEvalSha(checkScript.Hash(), keys, int64(5), int64(3), int64(60000)).SetVal(reply)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var allowed, denied int
+		for range replies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := strategy.CheckLimit(context.Background(), &Request{Key: "export", Limit: 5, Duration: time.Minute, Cost: 3})
+				assert.NoError(t, err)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if result.Result == Allow {
+					allowed++
+				} else {
+					denied++
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, allowed)
+		assert.Equal(t, 3, denied)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
+
+func TestRedisLimiterCalendarWindow(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	strategy := NewRedisLimiter(db, mockNow)
+
+	t.Run("Should reset at the end of the calendar window", func(t *testing.T) {
+		resetAt := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+		clientMock.ExpectEvalSha(checkScript.Hash(), []string{"limit:plan", "bonus:plan"}, int64(100), int64(1), int64(3600000)).SetVal([]interface{}{int64(1), int64(11), int64(100), int64(3599000)})
+
+		result, err := strategy.CheckLimit(context.Background(), &Request{Key: "plan", Limit: 100, Duration: time.Hour, ResetAt: resetAt})
+
+		assert.NoError(t, err)
+		assert.Equal(t, resetAt, result.ExpiresAt)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should start the window of a single request with its expiration", func(t *testing.T) {
+		resetAt := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+		// the first request of the period creates the counter, and the script
+		// gives it the time left until the reset in the same call
+		clientMock.ExpectEvalSha(checkScript.Hash(), []string{"limit:plan", "bonus:plan"}, int64(100), int64(1), int64(90000)).SetVal([]interface{}{int64(1), int64(1), int64(100), int64(90000)})
+
+		result, err := strategy.CheckLimit(context.Background(), &Request{Key: "plan", Limit: 100, Duration: 90 * time.Second, ResetAt: resetAt})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Allow, result.Result)
+		assert.Equal(t, int64(1), result.Total)
+		assert.Equal(t, resetAt, result.ExpiresAt)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should read the billing anchor of the token", func(t *testing.T) {
+		clientMock.ExpectGet("token_anchor:dummy_token").SetVal("2024-01-15T08:00:00Z")
+
+		anchor, err := strategy.CheckTokenAnchor(context.Background(), "dummy_token")
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC), anchor)
+	})
+
+	t.Run("Should return no anchor for tokens without one", func(t *testing.T) {
+		clientMock.ExpectGet("token_anchor:dummy_token").RedisNil()
+
+		anchor, err := strategy.CheckTokenAnchor(context.Background(), "dummy_token")
+
+		assert.NoError(t, err)
+		assert.True(t, anchor.IsZero())
+	})
+}
+
+func TestRedisLimiterRefund(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	strategy := NewRedisLimiter(db, mockNow)
+
+	t.Run("Should give the cost back to the counter", func(t *testing.T) {
+		clientMock.ExpectEvalSha(refundScript.Hash(), []string{"limit:worker"}, int64(2)).SetVal(int64(1))
+
+		err := strategy.Refund(context.Background(), &Request{Key: "worker", Cost: 2})
+
+		assert.NoError(t, err)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+}
+
+func TestRedisLimiterPeek(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	strategy := NewRedisLimiter(db, mockNow)
+	key := "limit:worker"
+
+	t.Run("Should read the counter without changing it", func(t *testing.T) {
+		clientMock.ExpectGet(key).SetVal("4")
+		clientMock.ExpectTTL(key).SetVal(30 * time.Second)
+		clientMock.ExpectGet("bonus:worker").RedisNil()
+
+		result, err := strategy.Peek(context.Background(), &Request{Key: "worker", Limit: 10, Duration: time.Minute})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Allow, result.Result)
+		assert.Equal(t, int64(4), result.Total)
+		assert.Equal(t, int64(6), result.Remaining)
+		assert.Equal(t, mockNow().Add(30*time.Second), result.ExpiresAt)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should report a full window for unknown keys", func(t *testing.T) {
+		// the mock stops the pipeline at the nil reply, leaving TTL unanswered
+		clientMock.ExpectGet(key).RedisNil()
+
+		result, err := strategy.Peek(context.Background(), &Request{Key: "worker", Limit: 10, Duration: time.Minute})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), result.Total)
+		assert.Equal(t, int64(10), result.Remaining)
+		assert.Equal(t, mockNow().Add(time.Minute), result.ExpiresAt)
+
+		clientMock.ClearExpect()
+	})
+}
+
+func TestRedisLimiterAdmin(t *testing.T) {
+	db, clientMock := redismock.NewClientMock()
+	strategy := NewRedisLimiter(db, mockNow)
+	request := &Request{Key: "worker", Limit: 10, Duration: time.Minute}
+
+	t.Run("Should raise the limit with a granted bonus", func(t *testing.T) {
+		clientMock.ExpectEvalSha(checkScript.Hash(), []string{"limit:worker", "bonus:worker"}, int64(10), int64(1), int64(60000)).SetVal([]interface{}{int64(1), int64(11), int64(15), int64(30000)})
+
+		result, err := strategy.CheckLimit(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Allow, result.Result)
+		assert.Equal(t, int64(15), result.Limit)
+		assert.Equal(t, int64(4), result.Remaining)
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should delete the counter on reset", func(t *testing.T) {
+		clientMock.ExpectDel("limit:worker").SetVal(1)
+
+		assert.NoError(t, strategy.Reset(context.Background(), request))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should set the usage keeping the window", func(t *testing.T) {
+		clientMock.ExpectEvalSha(setUsageScript.Hash(), []string{"limit:worker"}, int64(3), int64(60000)).SetVal("OK")
+
+		assert.NoError(t, strategy.SetUsage(context.Background(), request, 3))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should keep sub-millisecond windows at a millisecond when setting the usage", func(t *testing.T) {
+		short := &Request{Key: "worker", Limit: 10, Duration: time.Microsecond}
+		clientMock.ExpectEvalSha(setUsageScript.Hash(), []string{"limit:worker"}, int64(3), int64(1)).SetVal("OK")
+
+		assert.NoError(t, strategy.SetUsage(context.Background(), short, 3))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
+
+	t.Run("Should grant an expiring bonus", func(t *testing.T) {
+		clientMock.ExpectTxPipeline()
+		clientMock.ExpectIncrBy("bonus:worker", 50).SetVal(50)
+		clientMock.ExpectPExpire("bonus:worker", time.Hour).SetVal(true)
+		clientMock.ExpectTxPipelineExec()
+
+		assert.NoError(t, strategy.Grant(context.Background(), request, 50, time.Hour))
+		assert.NoError(t, clientMock.ExpectationsWereMet())
+	})
 }
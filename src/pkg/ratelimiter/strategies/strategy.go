@@ -12,10 +12,29 @@ const (
 	Deny  Result = -1
 )
 
+func (r Result) String() string {
+	if r == Deny {
+		return "deny"
+	}
+	return "allow"
+}
+
 type Request struct {
 	Key      string
 	Limit    int64
 	Duration time.Duration
+	// Cost is how much the request counts against the limit, 1 when unset.
+	Cost int64
+	// ResetAt, when set, is the instant the window ends, for windows aligned
+	// to the calendar. Duration is then the time left until it.
+	ResetAt time.Time
+}
+
+func (r *Request) EffectiveCost() int64 {
+	if r.Cost <= 0 {
+		return 1
+	}
+	return r.Cost
 }
 
 type LimitResponse struct {
@@ -24,9 +43,32 @@ type LimitResponse struct {
 	Total     int64
 	Remaining int64
 	ExpiresAt time.Time
+	Rule      string
+	Key       string
+	KeyType   string
+	Shadow    bool
+	// Shadows holds the results of the shadow rules evaluated with the request
+	Shadows []*LimitResponse
+	// Request is what was counted, kept to refund it once the response is known.
+	// RefundStatuses are the response statuses the rule refunds.
+	Request        *Request
+	RefundStatuses []string
 }
 
 type LimiterStrategyInterface interface {
 	CheckTokenLimit(ctx context.Context, token string) (int64, error)
+	// CheckTokenAnchor returns the start of the billing cycle of the token,
+	// zero when it has none.
+	CheckTokenAnchor(ctx context.Context, token string) (time.Time, error)
 	CheckLimit(ctx context.Context, r *Request) (*LimitResponse, error)
+	// Refund gives back the cost of an allowed request in the current window.
+	Refund(ctx context.Context, r *Request) error
+	// Peek tells what CheckLimit would decide without counting the request.
+	Peek(ctx context.Context, r *Request) (*LimitResponse, error)
+	// Reset clears the counter of the request key.
+	Reset(ctx context.Context, r *Request) error
+	// SetUsage sets how much of the current window the key has used.
+	SetUsage(ctx context.Context, r *Request, used int64) error
+	// Grant raises the limit of the key by bonus until ttl elapses.
+	Grant(ctx context.Context, r *Request, bonus int64, ttl time.Duration) error
 }
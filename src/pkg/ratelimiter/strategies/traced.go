@@ -0,0 +1,164 @@
+package strategies
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TracerName = "github.com/CaiqueRibeiro/rate-limiter-challenge/src/pkg/ratelimiter/strategies"
+
+// TracedStrategy decorates a strategy with a span around each of its calls.
+// Spans are created from the global tracer provider.
+type TracedStrategy struct {
+	LimiterStrategyInterface
+	Name string
+}
+
+func NewTracedStrategy(strategy LimiterStrategyInterface, name string) *TracedStrategy {
+	return &TracedStrategy{
+		LimiterStrategyInterface: strategy,
+		Name:                     name,
+	}
+}
+
+func (ts *TracedStrategy) CheckTokenLimit(ctx context.Context, token string) (int64, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, ts.Name+".CheckTokenLimit",
+		trace.WithAttributes(attribute.String("ratelimiter.strategy", ts.Name)),
+	)
+	defer span.End()
+
+	limit, err := ts.LimiterStrategyInterface.CheckTokenLimit(ctx, token)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("ratelimiter.token_found", false))
+		return limit, err
+	}
+
+	span.SetAttributes(
+		attribute.Bool("ratelimiter.token_found", true),
+		attribute.Int64("ratelimiter.limit", limit),
+	)
+
+	return limit, nil
+}
+
+func (ts *TracedStrategy) CheckTokenAnchor(ctx context.Context, token string) (time.Time, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, ts.Name+".CheckTokenAnchor",
+		trace.WithAttributes(attribute.String("ratelimiter.strategy", ts.Name)),
+	)
+	defer span.End()
+
+	anchor, err := ts.LimiterStrategyInterface.CheckTokenAnchor(ctx, token)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "check token anchor failed")
+		return anchor, err
+	}
+
+	span.SetAttributes(attribute.Bool("ratelimiter.anchor_found", !anchor.IsZero()))
+
+	return anchor, nil
+}
+
+func (ts *TracedStrategy) CheckLimit(ctx context.Context, r *Request) (*LimitResponse, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, ts.Name+".CheckLimit",
+		trace.WithAttributes(
+			attribute.String("ratelimiter.strategy", ts.Name),
+			attribute.Int64("ratelimiter.limit", r.Limit),
+			attribute.Int64("ratelimiter.window_ms", r.Duration.Milliseconds()),
+		),
+	)
+	defer span.End()
+
+	result, err := ts.LimiterStrategyInterface.CheckLimit(ctx, r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "check limit failed")
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("ratelimiter.decision", result.Result.String()),
+		attribute.Int64("ratelimiter.remaining", result.Remaining),
+	)
+
+	return result, nil
+}
+
+func (ts *TracedStrategy) Refund(ctx context.Context, r *Request) error {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, ts.Name+".Refund",
+		trace.WithAttributes(
+			attribute.String("ratelimiter.strategy", ts.Name),
+			attribute.Int64("ratelimiter.cost", r.EffectiveCost()),
+		),
+	)
+	defer span.End()
+
+	if err := ts.LimiterStrategyInterface.Refund(ctx, r); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "refund failed")
+		return err
+	}
+
+	return nil
+}
+
+func (ts *TracedStrategy) Peek(ctx context.Context, r *Request) (*LimitResponse, error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, ts.Name+".Peek",
+		trace.WithAttributes(
+			attribute.String("ratelimiter.strategy", ts.Name),
+			attribute.Int64("ratelimiter.limit", r.Limit),
+		),
+	)
+	defer span.End()
+
+	result, err := ts.LimiterStrategyInterface.Peek(ctx, r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "peek failed")
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int64("ratelimiter.remaining", result.Remaining))
+
+	return result, nil
+}
+
+func (ts *TracedStrategy) Reset(ctx context.Context, r *Request) error {
+	ctx, span := ts.startAdmin(ctx, "Reset")
+	defer span.End()
+
+	return ts.recordAdmin(span, ts.LimiterStrategyInterface.Reset(ctx, r))
+}
+
+func (ts *TracedStrategy) SetUsage(ctx context.Context, r *Request, used int64) error {
+	ctx, span := ts.startAdmin(ctx, "SetUsage")
+	defer span.End()
+
+	return ts.recordAdmin(span, ts.LimiterStrategyInterface.SetUsage(ctx, r, used))
+}
+
+func (ts *TracedStrategy) Grant(ctx context.Context, r *Request, bonus int64, ttl time.Duration) error {
+	ctx, span := ts.startAdmin(ctx, "Grant")
+	defer span.End()
+
+	return ts.recordAdmin(span, ts.LimiterStrategyInterface.Grant(ctx, r, bonus, ttl))
+}
+
+func (ts *TracedStrategy) startAdmin(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, ts.Name+"."+operation,
+		trace.WithAttributes(attribute.String("ratelimiter.strategy", ts.Name)),
+	)
+}
+
+func (ts *TracedStrategy) recordAdmin(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "admin operation failed")
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package strategies
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type failingStrategy struct{}
+
+func (f *failingStrategy) CheckTokenLimit(ctx context.Context, token string) (int64, error) {
+	return 0, errors.New("token not found")
+}
+
+func (f *failingStrategy) CheckTokenAnchor(ctx context.Context, token string) (time.Time, error) {
+	return time.Time{}, errors.New("redis unavailable")
+}
+
+func (f *failingStrategy) CheckLimit(ctx context.Context, r *Request) (*LimitResponse, error) {
+	return nil, errors.New("redis unavailable")
+}
+
+func (f *failingStrategy) Refund(ctx context.Context, r *Request) error {
+	return errors.New("redis unavailable")
+}
+
+func (f *failingStrategy) Peek(ctx context.Context, r *Request) (*LimitResponse, error) {
+	return nil, errors.New("redis unavailable")
+}
+
+func (f *failingStrategy) Reset(ctx context.Context, r *Request) error {
+	return errors.New("redis unavailable")
+}
+
+func (f *failingStrategy) SetUsage(ctx context.Context, r *Request, used int64) error {
+	return errors.New("redis unavailable")
+}
+
+func (f *failingStrategy) Grant(ctx context.Context, r *Request, bonus int64, ttl time.Duration) error {
+	return errors.New("redis unavailable")
+}
+
+func TestTracedStrategy(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	strategy := NewTracedStrategy(&failingStrategy{}, "failing")
+
+	t.Run("Should record strategy errors", func(t *testing.T) {
+		_, err := strategy.CheckLimit(context.Background(), &Request{Key: "127.0.0.1", Limit: 5})
+
+		assert.Error(t, err)
+
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "failing.CheckLimit", spans[0].Name)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Contains(t, spans[0].Attributes, attribute.Int64("ratelimiter.limit", 5))
+
+		exporter.Reset()
+	})
+
+	t.Run("Should not expose the token", func(t *testing.T) {
+		_, err := strategy.CheckTokenLimit(context.Background(), "secret_token")
+
+		assert.Error(t, err)
+
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Contains(t, spans[0].Attributes, attribute.Bool("ratelimiter.token_found", false))
+		for _, attr := range spans[0].Attributes {
+			assert.NotEqual(t, "secret_token", attr.Value.Emit())
+		}
+
+		exporter.Reset()
+	})
+}